@@ -0,0 +1,193 @@
+package payment
+
+import "strings"
+
+// CheckResult is the outcome of one AVS or CSC check.
+type CheckResult string
+
+// Defines the outcomes of a check
+const (
+	CheckMatch        CheckResult = "match"
+	CheckNoMatch      CheckResult = "no_match"
+	CheckNotProcessed CheckResult = "not_processed"
+	CheckUnknown      CheckResult = "unknown"
+)
+
+// AVSResult decodes vpc_AVSResultCode, the Address Verification Service
+// compares the billing address sent in vpc_AVS_* with the issuer records.
+type AVSResult struct {
+	Code     string             `json:"code"`
+	Address  CheckResult        `json:"address"`
+	PostCode CheckResult        `json:"post_code"`
+	Message  ErrorMessageLocale `json:"message"`
+}
+
+// CSCResult decodes vpc_CSCResultCode, the check of the 3 or 4 digits
+// Card Security Code (CVV2, CVC2, CID).
+type CSCResult struct {
+	Code    string             `json:"code"`
+	Result  CheckResult        `json:"result"`
+	Message ErrorMessageLocale `json:"message"`
+}
+
+type avsCode struct {
+	address  CheckResult
+	postCode CheckResult
+	message  ErrorMessageLocale
+}
+
+var avsCodes = map[string]avsCode{
+	"X": {CheckMatch, CheckMatch, ErrorMessageLocale{
+		VN: "Địa chỉ và mã bưu chính (9 số) khớp",
+		EN: "Exact match, address and 9 digit postcode",
+	}},
+	"Y": {CheckMatch, CheckMatch, ErrorMessageLocale{
+		VN: "Địa chỉ và mã bưu chính (5 số) khớp",
+		EN: "Exact match, address and 5 digit postcode",
+	}},
+	"D": {CheckMatch, CheckMatch, ErrorMessageLocale{
+		VN: "Địa chỉ và mã bưu chính khớp (giao dịch quốc tế)",
+		EN: "Address and postcode match (international transaction)",
+	}},
+	"M": {CheckMatch, CheckMatch, ErrorMessageLocale{
+		VN: "Địa chỉ và mã bưu chính khớp (giao dịch quốc tế)",
+		EN: "Address and postcode match (international transaction)",
+	}},
+	"A": {CheckMatch, CheckNoMatch, ErrorMessageLocale{
+		VN: "Chỉ địa chỉ khớp, mã bưu chính không khớp",
+		EN: "Address match only",
+	}},
+	"B": {CheckMatch, CheckNotProcessed, ErrorMessageLocale{
+		VN: "Địa chỉ khớp, mã bưu chính chưa được kiểm tra",
+		EN: "Address match, postcode not verified",
+	}},
+	"W": {CheckNoMatch, CheckMatch, ErrorMessageLocale{
+		VN: "Mã bưu chính (9 số) khớp, địa chỉ không khớp",
+		EN: "9 digit postcode match, address not matched",
+	}},
+	"Z": {CheckNoMatch, CheckMatch, ErrorMessageLocale{
+		VN: "Mã bưu chính (5 số) khớp, địa chỉ không khớp",
+		EN: "5 digit postcode match, address not matched",
+	}},
+	"P": {CheckNotProcessed, CheckMatch, ErrorMessageLocale{
+		VN: "Mã bưu chính khớp, địa chỉ chưa được kiểm tra",
+		EN: "Postcode match, address not verified",
+	}},
+	"N": {CheckNoMatch, CheckNoMatch, ErrorMessageLocale{
+		VN: "Địa chỉ và mã bưu chính không khớp",
+		EN: "Address and postcode not matched",
+	}},
+	"C": {CheckNotProcessed, CheckNotProcessed, ErrorMessageLocale{
+		VN: "Địa chỉ và mã bưu chính chưa được kiểm tra (giao dịch quốc tế)",
+		EN: "Address and postcode not verified (international transaction)",
+	}},
+	"I": {CheckNotProcessed, CheckNotProcessed, ErrorMessageLocale{
+		VN: "Địa chỉ chưa được kiểm tra (giao dịch quốc tế)",
+		EN: "Address not verified (international transaction)",
+	}},
+	"G": {CheckNotProcessed, CheckNotProcessed, ErrorMessageLocale{
+		VN: "Ngân hàng phát hành không hỗ trợ AVS",
+		EN: "Issuer does not participate in AVS",
+	}},
+	"S": {CheckNotProcessed, CheckNotProcessed, ErrorMessageLocale{
+		VN: "Dịch vụ không được hỗ trợ",
+		EN: "Service not supported or address not verified",
+	}},
+	"U": {CheckNotProcessed, CheckNotProcessed, ErrorMessageLocale{
+		VN: "Không có thông tin địa chỉ",
+		EN: "Address unavailable or not verified",
+	}},
+	"R": {CheckNotProcessed, CheckNotProcessed, ErrorMessageLocale{
+		VN: "Hệ thống ngân hàng phát hành không sẵn sàng",
+		EN: "Issuer system is unavailable",
+	}},
+	"E": {CheckNotProcessed, CheckNotProcessed, ErrorMessageLocale{
+		VN: "Không có địa chỉ và mã bưu chính",
+		EN: "Address and postcode not provided",
+	}},
+	"0": {CheckNotProcessed, CheckNotProcessed, ErrorMessageLocale{
+		VN: "Không yêu cầu kiểm tra AVS",
+		EN: "AVS not requested",
+	}},
+	"UNSUPPORTED": {CheckNotProcessed, CheckNotProcessed, ErrorMessageLocale{
+		VN: "Không hỗ trợ AVS hoặc không có thông tin địa chỉ",
+		EN: "AVS not supported or no AVS data provided",
+	}},
+}
+
+type cscCode struct {
+	result  CheckResult
+	message ErrorMessageLocale
+}
+
+var cscCodes = map[string]cscCode{
+	"M": {CheckMatch, ErrorMessageLocale{
+		VN: "Mã CSC khớp",
+		EN: "Exact code match",
+	}},
+	"N": {CheckNoMatch, ErrorMessageLocale{
+		VN: "Mã CSC không đúng",
+		EN: "Code invalid or not matched",
+	}},
+	"P": {CheckNotProcessed, ErrorMessageLocale{
+		VN: "Mã CSC chưa được kiểm tra",
+		EN: "Code not processed",
+	}},
+	"S": {CheckNotProcessed, ErrorMessageLocale{
+		VN: "Thẻ không có mã CSC",
+		EN: "Merchant indicated CSC is not present on the card",
+	}},
+	"U": {CheckNotProcessed, ErrorMessageLocale{
+		VN: "Ngân hàng phát hành chưa đăng ký kiểm tra CSC",
+		EN: "Card issuer is not registered or certified",
+	}},
+	"UNSUPPORTED": {CheckNotProcessed, ErrorMessageLocale{
+		VN: "Không hỗ trợ CSC hoặc không có mã CSC",
+		EN: "CSC not supported or no CSC data provided",
+	}},
+}
+
+// some acquirers spell the CSC result out
+var cscAliases = map[string]string{
+	"MATCH":         "M",
+	"NO_MATCH":      "N",
+	"NOT_MATCHED":   "N",
+	"NOT_PROCESSED": "P",
+	"NOT_PRESENT":   "S",
+	"NOT_SUPPORTED": "UNSUPPORTED",
+}
+
+// DecodeAVSResult decodes a vpc_AVSResultCode. An empty code is
+// CheckNotProcessed, a code missing from the table is CheckUnknown.
+func DecodeAVSResult(code string) AVSResult {
+	key := strings.ToUpper(strings.TrimSpace(code))
+	if key == "" {
+		key = "UNSUPPORTED"
+	}
+
+	c, ok := avsCodes[key]
+	if !ok {
+		return AVSResult{Code: code, Address: CheckUnknown, PostCode: CheckUnknown, Message: UnknownResponseMessage}
+	}
+
+	return AVSResult{Code: code, Address: c.address, PostCode: c.postCode, Message: c.message}
+}
+
+// DecodeCSCResult decodes a vpc_CSCResultCode, both the letter codes and
+// the spelled out ones (MATCH, NO_MATCH, ...) are accepted.
+func DecodeCSCResult(code string) CSCResult {
+	key := strings.ToUpper(strings.TrimSpace(code))
+	if key == "" {
+		key = "UNSUPPORTED"
+	}
+	if alias, ok := cscAliases[key]; ok {
+		key = alias
+	}
+
+	c, ok := cscCodes[key]
+	if !ok {
+		return CSCResult{Code: code, Result: CheckUnknown, Message: UnknownResponseMessage}
+	}
+
+	return CSCResult{Code: code, Result: c.result, Message: c.message}
+}
@@ -0,0 +1,47 @@
+package payment
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAVSAndCSC(t *testing.T) {
+	Convey("AVS and CSC", t, func() {
+		Convey("decodes AVS codes", func() {
+			avs := DecodeAVSResult("Y")
+			So(avs.Address, ShouldEqual, CheckMatch)
+			So(avs.PostCode, ShouldEqual, CheckMatch)
+
+			avs = DecodeAVSResult("Z")
+			So(avs.Address, ShouldEqual, CheckNoMatch)
+			So(avs.PostCode, ShouldEqual, CheckMatch)
+
+			avs = DecodeAVSResult("Unsupported")
+			So(avs.Address, ShouldEqual, CheckNotProcessed)
+
+			avs = DecodeAVSResult("?")
+			So(avs.Code, ShouldEqual, "?")
+			So(avs.Address, ShouldEqual, CheckUnknown)
+			So(avs.Message, ShouldResemble, UnknownResponseMessage)
+		})
+
+		Convey("decodes CSC codes and their spelled out form", func() {
+			So(DecodeCSCResult("M").Result, ShouldEqual, CheckMatch)
+			So(DecodeCSCResult("MATCH").Result, ShouldEqual, CheckMatch)
+			So(DecodeCSCResult("N").Result, ShouldEqual, CheckNoMatch)
+			So(DecodeCSCResult("P").Result, ShouldEqual, CheckNotProcessed)
+			So(DecodeCSCResult("").Result, ShouldEqual, CheckNotProcessed)
+			So(DecodeCSCResult("Q").Result, ShouldEqual, CheckUnknown)
+		})
+
+		Convey("is filled by PostProcess", func() {
+			resp := &InternationalResponse{VPCAVSResultCode: "A", VPCCSCResultCode: "N"}
+			resp.PostProcess()
+			So(resp.AVSResult.Address, ShouldEqual, CheckMatch)
+			So(resp.AVSResult.PostCode, ShouldEqual, CheckNoMatch)
+			So(resp.CSCResult.Result, ShouldEqual, CheckNoMatch)
+			So(resp.CSCResult.Message.EN, ShouldEqual, "Code invalid or not matched")
+		})
+	})
+}
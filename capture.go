@@ -0,0 +1,169 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CaptureParams ...
+type CaptureParams struct {
+	// MerchTxnRef must be unique per capture.
+	MerchTxnRef string `validate:"required,max=40"`
+	// TransactionNo is the vpc_TransactionNo of the authorization.
+	TransactionNo string `validate:"required"`
+	// Money may be lower than the authorized amount for a partial capture,
+	// its Currency defaults to the Currency of the client.
+	Money Money `validate:"-"`
+	// Amount is in whole units, ignored when Money is set.
+	//
+	// Deprecated: use Money, Amount cannot hold cents.
+	Amount int64 `validate:"omitempty,gt=0,lte=9999999999"`
+}
+
+// VoidParams ...
+type VoidParams struct {
+	// MerchTxnRef must be unique per void.
+	MerchTxnRef string `validate:"required,max=40"`
+	// TransactionNo is the vpc_TransactionNo of the authorization.
+	TransactionNo string `validate:"required"`
+}
+
+// AuthorizationResponse is returned by Capture and Void, it carries the
+// running totals of the authorization.
+type AuthorizationResponse struct {
+	VPCCommand          string `json:"vpc_Command" query:"vpc_Command" schema:"vpc_Command"`
+	VPCMerchant         string `json:"vpc_Merchant" query:"vpc_Merchant" schema:"vpc_Merchant"`
+	VPCMerchTxnRef      string `json:"vpc_MerchTxnRef" query:"vpc_MerchTxnRef" schema:"vpc_MerchTxnRef"`
+	VPCTransactionNo    string `json:"vpc_TransactionNo" query:"vpc_TransactionNo" schema:"vpc_TransactionNo"`
+	VPCAmount           int64  `json:"vpc_Amount" query:"vpc_Amount" schema:"vpc_Amount"`
+	VPCAuthorisedAmount int64  `json:"vpc_AuthorisedAmount" query:"vpc_AuthorisedAmount" schema:"vpc_AuthorisedAmount"`
+	VPCCapturedAmount   int64  `json:"vpc_CapturedAmount" query:"vpc_CapturedAmount" schema:"vpc_CapturedAmount"`
+	VPCRefundedAmount   int64  `json:"vpc_RefundedAmount" query:"vpc_RefundedAmount" schema:"vpc_RefundedAmount"`
+	VPCMessage          string `json:"vpc_Message" query:"vpc_Message" schema:"vpc_Message"`
+	VPCTxnResponseCode  string `json:"vpc_TxnResponseCode" query:"vpc_TxnResponseCode" schema:"vpc_TxnResponseCode"`
+	VPCSecureHash       string `json:"vpc_SecureHash" query:"vpc_SecureHash" schema:"vpc_SecureHash"`
+
+	TxnResponseMessage ErrorMessageLocale `json:"txnResponseCode" query:"txnResponseCode" schema:"txnResponseCode"`
+
+	// Money, AuthorisedMoney, CapturedMoney and RefundedMoney are the exact
+	// VPCAmount, VPCAuthorisedAmount, VPCCapturedAmount and VPCRefundedAmount
+	Money           Money `json:"money" query:"-" schema:"-"`
+	AuthorisedMoney Money `json:"authorised_money" query:"-" schema:"-"`
+	CapturedMoney   Money `json:"captured_money" query:"-" schema:"-"`
+	RefundedMoney   Money `json:"refunded_money" query:"-" schema:"-"`
+
+	// currency is the one of the client, the gateway does not send it
+	currency string
+}
+
+// PostProcess ...
+func (r *AuthorizationResponse) PostProcess() {
+	r.Money = moneyFromGateway(r.VPCAmount, r.currency)
+	r.AuthorisedMoney = moneyFromGateway(r.VPCAuthorisedAmount, r.currency)
+	r.CapturedMoney = moneyFromGateway(r.VPCCapturedAmount, r.currency)
+	r.RefundedMoney = moneyFromGateway(r.VPCRefundedAmount, r.currency)
+	r.VPCAmount = r.VPCAmount / 100
+	r.VPCAuthorisedAmount = r.VPCAuthorisedAmount / 100
+	r.VPCCapturedAmount = r.VPCCapturedAmount / 100
+	r.VPCRefundedAmount = r.VPCRefundedAmount / 100
+	r.TxnResponseMessage = responseMessage(ChannelInternational, r.VPCTxnResponseCode)
+}
+
+// Approved ...
+func (r *AuthorizationResponse) Approved() bool {
+	return r.VPCTxnResponseCode == "0"
+}
+
+// Remaining is the authorized amount not captured yet, in whole units.
+//
+// Deprecated: use RemainingMoney, Remaining cannot hold cents.
+func (r *AuthorizationResponse) Remaining() int64 {
+	return r.VPCAuthorisedAmount - r.VPCCapturedAmount
+}
+
+// RemainingMoney is the exact authorized amount not captured yet.
+func (r *AuthorizationResponse) RemainingMoney() Money {
+	return Money{
+		Amount:   r.AuthorisedMoney.Amount - r.CapturedMoney.Amount,
+		Currency: r.AuthorisedMoney.Currency,
+	}
+}
+
+func capture(ctx context.Context, cfg *Config, currency string, params *CaptureParams) (*AuthorizationResponse, error) {
+	if cfg == nil {
+		return nil, ErrNilConfig
+	}
+
+	err := validateStruct(params)
+	if err != nil {
+		return nil, err
+	}
+
+	money, err := resolveMoney(params.Amount, params.Money, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := money.gatewayAmount()
+	if err != nil {
+		return nil, err
+	}
+
+	v := url.Values{}
+
+	v.Add("vpc_Command", "capture")
+	v.Add("vpc_MerchTxnRef", params.MerchTxnRef)
+	v.Add("vpc_TransNo", params.TransactionNo)
+	v.Add("vpc_Amount", strconv.FormatInt(amount, 10))
+
+	return requestAuthorization(ctx, cfg, money.Currency, v)
+}
+
+func void(ctx context.Context, cfg *Config, currency string, params *VoidParams) (*AuthorizationResponse, error) {
+	if cfg == nil {
+		return nil, ErrNilConfig
+	}
+
+	err := validateStruct(params)
+	if err != nil {
+		return nil, err
+	}
+
+	v := url.Values{}
+
+	v.Add("vpc_Command", "voidAuthorisation")
+	v.Add("vpc_MerchTxnRef", params.MerchTxnRef)
+	v.Add("vpc_TransNo", params.TransactionNo)
+
+	return requestAuthorization(ctx, cfg, currency, v)
+}
+
+func requestAuthorization(ctx context.Context, cfg *Config, currency string, v url.Values) (*AuthorizationResponse, error) {
+	err := checkCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	v.Add("vpc_Version", "1")
+	v.Add("vpc_Merchant", cfg.Merchant)
+	v.Add("vpc_AccessCode", cfg.AccessCode)
+	v.Add("vpc_User", cfg.User)
+	v.Add("vpc_Password", cfg.Password)
+
+	res, err := requestDPS(ctx, cfg, http.MethodPost, v)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp = &AuthorizationResponse{currency: currency}
+	err = decodeDPSResponse(res, cfg, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.PostProcess()
+
+	return resp, declineError(ChannelInternational, resp.VPCTxnResponseCode)
+}
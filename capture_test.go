@@ -0,0 +1,47 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCapture(t *testing.T) {
+	Convey("Capture and Void", t, func() {
+		op := NewSandboxInternational("https://example.com/callback")
+		op.Currency = "USD"
+
+		var sent *http.Request
+		op.Cfg.HTTPClient = &http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				sent = req
+				return nil, errors.New("not sent")
+			}),
+		}
+
+		Convey("require User and Password", func() {
+			_, err := op.Capture(context.Background(), &CaptureParams{
+				MerchTxnRef:   "capture-1",
+				TransactionNo: "1",
+				Money:         Money{Amount: 325, Currency: "USD"},
+			})
+			var cerr *ConfigError
+			So(errors.As(err, &cerr), ShouldBeTrue)
+			So(cerr.Fields, ShouldHaveLength, 2)
+			So(cerr.Fields[0].Field, ShouldEqual, "user")
+			So(cerr.Fields[1].Field, ShouldEqual, "password")
+
+			_, err = op.Void(context.Background(), &VoidParams{
+				MerchTxnRef:   "void-1",
+				TransactionNo: "1",
+			})
+			So(errors.As(err, &cerr), ShouldBeTrue)
+			So(errors.Is(err, ErrValidation), ShouldBeTrue)
+
+			So(sent, ShouldBeNil)
+		})
+	})
+}
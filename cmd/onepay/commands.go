@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tranduythanh/payment"
+)
+
+func checkout(args []string, stdout, stderr io.Writer) error {
+	var gf gatewayFlags
+	var params payment.CheckoutParams
+	var returnURL, amount, currency string
+
+	fs := newFlagSet("checkout", stderr)
+	gf.register(fs)
+	fs.StringVar(&returnURL, "return-url", "", "override ReturnURL of the config")
+	fs.StringVar(&params.MerchTxnRef, "ref", "", "vpc_MerchTxnRef, unique per checkout")
+	fs.StringVar(&amount, "amount", "", "amount, decimals allowed by the currency: 100000 or 10.50")
+	fs.StringVar(&currency, "currency", payment.DefaultCurrency, "ISO 4217 currency, other than VND needs -channel international")
+	fs.StringVar(&params.OrderInfo, "order-info", "", "vpc_OrderInfo")
+	fs.StringVar(&params.TicketNo, "ticket", "127.0.0.1", "vpc_TicketNo, IP of the customer")
+	fs.StringVar(&params.Title, "title", "OnePay", "title of the payment page")
+	fs.StringVar(&params.AgainLink, "again-link", "", "link back to the merchant site")
+	fs.BoolVar(&params.Authorize, "authorize", false, "authorize only, international channel")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	gw, cfg, err := gf.gateway()
+	if err != nil {
+		return err
+	}
+
+	if returnURL != "" {
+		cfg.ReturnURL = returnURL
+	}
+
+	params.Money, err = payment.ParseMoney(amount, currency)
+	if err != nil {
+		return err
+	}
+
+	checkoutURL, err := gw.BuildCheckoutURL(&params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, checkoutURL)
+	return nil
+}
+
+func verify(args []string, stdout, stderr io.Writer) error {
+	var gf gatewayFlags
+
+	fs := newFlagSet("verify", stderr)
+	gf.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: onepay verify [flags] <callback URL or query string>")
+		fs.PrintDefaults()
+	}
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("verify takes exactly one callback URL")
+	}
+
+	v, err := parseQuery(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	gw, _, err := gf.gateway()
+	if err != nil {
+		return err
+	}
+
+	result, err := gw.HandleResult(v)
+	if err != nil {
+		return err
+	}
+
+	// only the channel specific response, it carries every decoded field
+	if result.Domestic != nil {
+		return printJSON(stdout, result.Domestic)
+	}
+	return printJSON(stdout, result.International)
+}
+
+func hash(args []string, stdout, stderr io.Writer) error {
+	var config string
+
+	fs := newFlagSet("hash", stderr)
+	fs.StringVar(&config, "config", "", "YAML or JSON config file holding the SecureSecret")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: onepay hash [-config <file>] <URL or query string>")
+		fmt.Fprintln(fs.Output(), "The SecureSecret is read from -config or ONEPAY_SECURE_SECRET.")
+		fs.PrintDefaults()
+	}
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	secret := os.Getenv(payment.EnvPrefix + "SECURE_SECRET")
+	if config != "" {
+		cfg, err := payment.LoadConfig(config)
+		if err != nil {
+			return err
+		}
+		secret = cfg.SecureSecret
+	}
+
+	if fs.NArg() != 1 || secret == "" {
+		fs.Usage()
+		return errors.New("hash takes a SecureSecret and exactly one query string")
+	}
+
+	v, err := parseQuery(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	sha, err := payment.SecureHash(v, secret)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, sha)
+	return nil
+}
+
+func queryDR(args []string, stdout, stderr io.Writer) error {
+	var gf gatewayFlags
+	var request payment.QueryDRAPIRequest
+	var timeout time.Duration
+
+	fs := newFlagSet("querydr", stderr)
+	gf.register(fs)
+	fs.StringVar(&request.VPCMerchTxnRef, "ref", "", "vpc_MerchTxnRef to look up")
+	fs.StringVar(&request.VPCUser, "user", "", "override User of the config")
+	fs.DurationVar(&timeout, "timeout", payment.DefaultHTTPTimeout, "request timeout")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	gw, _, err := gf.gateway()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	res, err := gw.QueryDR(ctx, &request)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(stdout, res)
+}
+
+// parseQuery accepts a full URL, or only its query string.
+func parseQuery(s string) (url.Values, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "?"); i >= 0 {
+		s = s[i+1:]
+	}
+	return url.ParseQuery(s)
+}
@@ -0,0 +1,172 @@
+// Command onepay builds, signs and verifies OnePay requests.
+//
+//	onepay checkout -config onepay.json -ref 123 -amount 100000 -order-info "Order 123"
+//	onepay checkout -channel international -ref 124 -amount 10.50 -currency USD -order-info "Order 124"
+//	onepay verify -channel international 'https://shop/callback?vpc_...'
+//	ONEPAY_SECURE_SECRET=A3EFDFABA8653DF2342E8DAC29B51AF0 onepay hash 'vpc_Amount=100&vpc_...'
+//	onepay querydr -config onepay.json -ref 123
+//
+// Without -config the OnePay sandbox of -channel is used. Secrets are never
+// flags, where ps would show them: they come from the config file or from
+// ONEPAY_SECURE_SECRET, ONEPAY_USER and ONEPAY_PASSWORD.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tranduythanh/payment"
+)
+
+const usage = `Usage: onepay <command> [flags]
+
+Commands:
+  checkout   build a signed checkout URL
+  verify     verify a callback URL and print the decoded response
+  hash       compute vpc_SecureHash of a query string
+  querydr    query the status of a MerchTxnRef
+
+Run 'onepay <command> -h' for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// errUsage is returned for flags the FlagSet already reported.
+var errUsage = errors.New("invalid flags")
+
+// run dispatches args to a command and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) < 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "checkout":
+		err = checkout(args, stdout, stderr)
+	case "verify":
+		err = verify(args, stdout, stderr)
+	case "hash":
+		err = hash(args, stdout, stderr)
+	case "querydr":
+		err = queryDR(args, stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+	default:
+		fmt.Fprintf(stderr, "onepay: unknown command %q\n\n%s", cmd, usage)
+		return 2
+	}
+
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "onepay: %v\n", err)
+		return 1
+	}
+}
+
+// newFlagSet reports to stderr instead of exiting, so run picks the code.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return err
+	}
+	if err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// gatewayFlags are shared by the commands talking to a gateway.
+type gatewayFlags struct {
+	config  string
+	channel string
+}
+
+func (f *gatewayFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.config, "config", "", "YAML or JSON config file, ONEPAY_* env vars override it (default: OnePay sandbox)")
+	fs.StringVar(&f.channel, "channel", string(payment.ChannelDomestic), "domestic or international")
+}
+
+func (f *gatewayFlags) gateway() (payment.Gateway, *payment.Config, error) {
+	var cfg *payment.Config
+	if f.config != "" {
+		var err error
+		cfg, err = payment.LoadConfig(f.config)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var gw payment.Gateway
+	switch payment.Channel(f.channel) {
+	case payment.ChannelDomestic:
+		op := payment.NewSandboxDomestic("")
+		if cfg != nil {
+			var err error
+			op, err = payment.NewDomestic(cfg)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		cfg = op.Cfg
+		gw = op
+	case payment.ChannelInternational:
+		op := payment.NewSandboxInternational("")
+		if cfg != nil {
+			var err error
+			op, err = payment.NewInternational(cfg)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		cfg = op.Cfg
+		gw = op
+	default:
+		return nil, nil, fmt.Errorf("unknown channel %q", f.channel)
+	}
+
+	// LoadConfig has applied them already
+	if f.config == "" {
+		applySecrets(cfg)
+	}
+
+	return gw, cfg, nil
+}
+
+// applySecrets overrides the credentials of the sandbox with the ONEPAY_*
+// environment variables.
+func applySecrets(cfg *payment.Config) {
+	if v, ok := os.LookupEnv(payment.EnvPrefix + "SECURE_SECRET"); ok {
+		cfg.SecureSecret = v
+	}
+	if v, ok := os.LookupEnv(payment.EnvPrefix + "USER"); ok {
+		cfg.User = v
+	}
+	if v, ok := os.LookupEnv(payment.EnvPrefix + "PASSWORD"); ok {
+		cfg.Password = v
+	}
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tranduythanh/payment"
+)
+
+func TestRun(t *testing.T) {
+	Convey("onepay", t, func() {
+		var stdout, stderr bytes.Buffer
+		onepay := func(args ...string) int {
+			stdout.Reset()
+			stderr.Reset()
+			return run(args, &stdout, &stderr)
+		}
+
+		Convey("prints the usage", func() {
+			So(onepay(), ShouldEqual, 2)
+			So(stderr.String(), ShouldContainSubstring, "Usage: onepay")
+
+			So(onepay("help"), ShouldEqual, 0)
+			So(stdout.String(), ShouldContainSubstring, "Commands:")
+
+			So(onepay("refund"), ShouldEqual, 2)
+			So(stderr.String(), ShouldContainSubstring, `unknown command "refund"`)
+		})
+
+		Convey("reports invalid flags", func() {
+			So(onepay("checkout", "-nope"), ShouldEqual, 2)
+			So(stderr.String(), ShouldContainSubstring, "-nope")
+
+			So(onepay("querydr", "-h"), ShouldEqual, 0)
+			So(stderr.String(), ShouldContainSubstring, "-ref")
+		})
+
+		Convey("does not take secrets as flags", func() {
+			So(onepay("hash", "-secret", "A3EF", "vpc_Amount=100"), ShouldEqual, 2)
+			So(onepay("querydr", "-password", "x", "-ref", "1"), ShouldEqual, 2)
+			So(onepay("verify", "-secret", "A3EF", "vpc_Amount=100"), ShouldEqual, 2)
+		})
+
+		Convey("hash reads ONEPAY_SECURE_SECRET", func() {
+			secret := "A3EFDFABA8653DF2342E8DAC29B51AF0"
+			t.Setenv(payment.EnvPrefix+"SECURE_SECRET", "")
+
+			So(onepay("hash", "vpc_Amount=100"), ShouldEqual, 1)
+
+			t.Setenv(payment.EnvPrefix+"SECURE_SECRET", secret)
+
+			v := url.Values{}
+			v.Set("vpc_Amount", "100")
+			want, err := payment.SecureHash(v, secret)
+			So(err, ShouldBeNil)
+
+			So(onepay("hash", "https://shop/callback?vpc_Amount=100"), ShouldEqual, 0)
+			So(strings.TrimSpace(stdout.String()), ShouldEqual, want)
+		})
+
+		Convey("checkout signs with the sandbox and verify checks it", func() {
+			So(onepay("checkout", "-ref", "ref-1", "-amount", "100000", "-order-info", "order 1", "-again-link", "https://shop/cart"), ShouldEqual, 0)
+
+			u, err := url.Parse(strings.TrimSpace(stdout.String()))
+			So(err, ShouldBeNil)
+			So(u.Query().Get("vpc_MerchTxnRef"), ShouldEqual, "ref-1")
+			So(u.Query().Get("vpc_Amount"), ShouldEqual, "10000000")
+
+			v := u.Query()
+			v.Set("vpc_TxnResponseCode", "0")
+			v.Set(payment.VPCSecureHashKey, "")
+			hash, err := payment.SecureHash(v, payment.NewSandboxDomestic("").Cfg.SecureSecret)
+			So(err, ShouldBeNil)
+			v.Set(payment.VPCSecureHashKey, hash)
+
+			So(onepay("verify", v.Encode()), ShouldEqual, 0)
+			So(stdout.String(), ShouldContainSubstring, `"vpc_MerchTxnRef": "ref-1"`)
+
+			Convey("with the secret of ONEPAY_SECURE_SECRET", func() {
+				t.Setenv(payment.EnvPrefix+"SECURE_SECRET", "00112233445566778899AABBCCDDEEFF")
+
+				So(onepay("verify", v.Encode()), ShouldEqual, 1)
+				So(stderr.String(), ShouldContainSubstring, payment.ErrInvalidSignature.Error())
+			})
+		})
+	})
+}
@@ -0,0 +1,505 @@
+package payment
+
+// ResponseCode describes a vpc_TxnResponseCode of one channel.
+type ResponseCode struct {
+	Code    string
+	Message ErrorMessageLocale
+	Status  Status
+	// Retryable is true when a new attempt of the customer (another
+	// card, the right OTP, ...) may succeed, false when the merchant has
+	// to fix something first or the transaction is already settled.
+	Retryable bool
+}
+
+// UnknownResponseMessage is the message of a code missing from the tables.
+var UnknownResponseMessage = ErrorMessageLocale{
+	VN: "Mã phản hồi không xác định",
+	EN: "Unknown response code",
+}
+
+// pendingResponseCode is used while the gateway has not answered yet.
+var pendingResponseCode = ResponseCode{
+	Message: ErrorMessageLocale{
+		VN: "Giao dịch đang chờ xử lý",
+		EN: "Transaction pending",
+	},
+	Status:    StatusPending,
+	Retryable: true,
+}
+
+// DomesticResponseCodes are the codes of the domestic (ATM card) gateway.
+var DomesticResponseCodes = map[string]ResponseCode{
+	"0": {
+		Code: "0",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch thành công",
+			EN: "Approved",
+		},
+		Status: StatusApproved,
+	},
+	"1": {
+		Code: "1",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch không thành công. Ngân hàng phát hành thẻ từ chối cấp phép cho giao dịch. Vui lòng liên hệ ngân hàng theo số điện thoại sau mặt thẻ để biết chính xác nguyên nhân Ngân hàng từ chối.",
+			EN: "The transaction is unsuccessful. This transaction has been declined by issuer bank. Please contact your bank for further clarification.",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"3": {
+		Code: "3",
+		Message: ErrorMessageLocale{
+			VN: "Mã đơn vị không tồn tại",
+			EN: "Merchant not exist",
+		},
+		Status: StatusDeclined,
+	},
+	"4": {
+		Code: "4",
+		Message: ErrorMessageLocale{
+			VN: "Không đúng access code",
+			EN: "Invalid access code",
+		},
+		Status: StatusDeclined,
+	},
+	"5": {
+		Code: "5",
+		Message: ErrorMessageLocale{
+			VN: "Số tiền không hợp lệ",
+			EN: "Invalid amount",
+		},
+		Status: StatusDeclined,
+	},
+	"6": {
+		Code: "6",
+		Message: ErrorMessageLocale{
+			VN: "Mã tiền tệ không tồn tại",
+			EN: "Invalid currency code",
+		},
+		Status: StatusDeclined,
+	},
+	"7": {
+		Code: "7",
+		Message: ErrorMessageLocale{
+			VN: "Lỗi không xác định",
+			EN: "Unspecified Failure ",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"8": {
+		Code: "8",
+		Message: ErrorMessageLocale{
+			VN: "Số thẻ không đúng",
+			EN: "Invalid card Number",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"9": {
+		Code: "9",
+		Message: ErrorMessageLocale{
+			VN: "Tên chủ thẻ không đúng",
+			EN: "Invalid card name",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"10": {
+		Code: "10",
+		Message: ErrorMessageLocale{
+			VN: "Thẻ hết hạn/Thẻ bị khóa",
+			EN: "Expired Card",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"11": {
+		Code: "11",
+		Message: ErrorMessageLocale{
+			VN: "Thẻ chưa đăng ký sử dụng dịch vụ",
+			EN: "Card Not Registed Service(internet banking)",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"12": {
+		Code: "12",
+		Message: ErrorMessageLocale{
+			VN: "Ngày phát hành/Hết hạn không đúng",
+			EN: "Invalid card date",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"13": {
+		Code: "13",
+		Message: ErrorMessageLocale{
+			VN: "Vượt quá hạn mức thanh toán",
+			EN: "Exist Amount",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"21": {
+		Code: "21",
+		Message: ErrorMessageLocale{
+			VN: "Số tiền không đủ để thanh toán",
+			EN: "Insufficient fund",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"22": {
+		Code: "22",
+		Message: ErrorMessageLocale{
+			VN: "Thông tin tài khoản không đúng",
+			EN: "Invalid Account",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"23": {
+		Code: "23",
+		Message: ErrorMessageLocale{
+			VN: "Tài khoản bị khóa",
+			EN: "Account Locked",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"24": {
+		Code: "24",
+		Message: ErrorMessageLocale{
+			VN: "Thông tin thẻ không đúng",
+			EN: "Invalid Card Info",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"25": {
+		Code: "25",
+		Message: ErrorMessageLocale{
+			VN: "OTP không đúng",
+			EN: "Invalid OTP",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"253": {
+		Code: "253",
+		Message: ErrorMessageLocale{
+			VN: "Quá thời gian thanh toán",
+			EN: "Transaction timeout",
+		},
+		Status:    StatusExpired,
+		Retryable: true,
+	},
+	"99": {
+		Code: "99",
+		Message: ErrorMessageLocale{
+			VN: "Người sử dụng hủy giao dịch",
+			EN: "User cancel",
+		},
+		Status:    StatusCancelled,
+		Retryable: true,
+	},
+}
+
+// InternationalResponseCodes are the codes of the international (Visa,
+// MasterCard, JCB, Amex) gateway, they follow the MIGS catalogue.
+var InternationalResponseCodes = map[string]ResponseCode{
+	"0": {
+		Code: "0",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch thành công",
+			EN: "Approved",
+		},
+		Status: StatusApproved,
+	},
+	"1": {
+		Code: "1",
+		Message: ErrorMessageLocale{
+			VN: "Ngân hàng phát hành thẻ từ chối giao dịch",
+			EN: "Transaction could not be processed, declined by the issuer bank",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"2": {
+		Code: "2",
+		Message: ErrorMessageLocale{
+			VN: "Ngân hàng phát hành thẻ từ chối giao dịch",
+			EN: "Bank declined transaction",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"3": {
+		Code: "3",
+		Message: ErrorMessageLocale{
+			VN: "Không nhận được phản hồi từ ngân hàng phát hành thẻ",
+			EN: "No reply from bank",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"4": {
+		Code: "4",
+		Message: ErrorMessageLocale{
+			VN: "Thẻ hết hạn",
+			EN: "Expired card",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"5": {
+		Code: "5",
+		Message: ErrorMessageLocale{
+			VN: "Thẻ không đủ số dư để thanh toán",
+			EN: "Insufficient funds",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"6": {
+		Code: "6",
+		Message: ErrorMessageLocale{
+			VN: "Lỗi kết nối tới ngân hàng phát hành thẻ",
+			EN: "Error communicating with bank",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"7": {
+		Code: "7",
+		Message: ErrorMessageLocale{
+			VN: "Lỗi hệ thống cổng thanh toán",
+			EN: "Payment server system error",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"8": {
+		Code: "8",
+		Message: ErrorMessageLocale{
+			VN: "Loại giao dịch không được hỗ trợ",
+			EN: "Transaction type not supported",
+		},
+		Status: StatusDeclined,
+	},
+	"9": {
+		Code: "9",
+		Message: ErrorMessageLocale{
+			VN: "Ngân hàng phát hành thẻ từ chối giao dịch (không liên hệ ngân hàng)",
+			EN: "Bank declined transaction (do not contact bank)",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"A": {
+		Code: "A",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch bị huỷ bỏ",
+			EN: "Transaction aborted",
+		},
+		Status:    StatusCancelled,
+		Retryable: true,
+	},
+	"B": {
+		Code: "B",
+		Message: ErrorMessageLocale{
+			VN: "Không xác thực được 3D-Secure",
+			EN: "The card used in this transaction is not authorized 3D-Secure complete",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"C": {
+		Code: "C",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch đã bị huỷ",
+			EN: "Transaction cancelled",
+		},
+		Status:    StatusCancelled,
+		Retryable: true,
+	},
+	"D": {
+		Code: "D",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch đã được tiếp nhận và đang chờ xử lý",
+			EN: "Deferred transaction has been received and is awaiting processing",
+		},
+		Status:    StatusPending,
+		Retryable: true,
+	},
+	"E": {
+		Code: "E",
+		Message: ErrorMessageLocale{
+			VN: "Nhập sai CSC (Card Security Card) hoặc ngân hàng từ chối cấp phép cho giao dịch",
+			EN: "You have entered wrong CSC or Issuer Bank declided transaction",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"F": {
+		Code: "F",
+		Message: ErrorMessageLocale{
+			VN: "Không xác thực được 3D-Secure",
+			EN: "3D Secure Authentication Failed",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"I": {
+		Code: "I",
+		Message: ErrorMessageLocale{
+			VN: "Mã bảo mật CSC không đúng",
+			EN: "Card security code verification failed",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"L": {
+		Code: "L",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch đang bị khoá, vui lòng thử lại sau",
+			EN: "Shopping transaction locked, please try again later",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"M": {
+		Code: "M",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch đã được gửi, chưa có phản hồi từ ngân hàng",
+			EN: "Transaction submitted, no response from acquirer",
+		},
+		Status:    StatusPending,
+		Retryable: true,
+	},
+	"N": {
+		Code: "N",
+		Message: ErrorMessageLocale{
+			VN: "Chủ thẻ chưa đăng ký xác thực 3D-Secure",
+			EN: "Cardholder is not enrolled in authentication scheme",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"P": {
+		Code: "P",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch đang được xử lý",
+			EN: "Transaction has been received by the payment adaptor and is being processed",
+		},
+		Status:    StatusPending,
+		Retryable: true,
+	},
+	"R": {
+		Code: "R",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch không được xử lý do vượt quá số lần thử cho phép",
+			EN: "Transaction was not processed, reached limit of retry attempts allowed",
+		},
+		Status: StatusDeclined,
+	},
+	"S": {
+		Code: "S",
+		Message: ErrorMessageLocale{
+			VN: "Trùng mã phiên giao dịch",
+			EN: "Duplicate session ID",
+		},
+		Status: StatusDeclined,
+	},
+	"T": {
+		Code: "T",
+		Message: ErrorMessageLocale{
+			VN: "Xác thực địa chỉ chủ thẻ không thành công",
+			EN: "Address verification failed",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"U": {
+		Code: "U",
+		Message: ErrorMessageLocale{
+			VN: "Mã bảo mật CSC không đúng",
+			EN: "Card security code failed",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"V": {
+		Code: "V",
+		Message: ErrorMessageLocale{
+			VN: "Xác thực địa chỉ và mã bảo mật CSC không thành công",
+			EN: "Address verification and card security code failed",
+		},
+		Status:    StatusDeclined,
+		Retryable: true,
+	},
+	"Z": {
+		Code: "Z",
+		Message: ErrorMessageLocale{
+			VN: "Giao dịch không thành công do vi phạm quy định của hệ thống",
+			EN: "Transaction restricted due to OFD’s policies",
+		},
+		Status: StatusDeclined,
+	},
+	"253": {
+		Code: "253",
+		Message: ErrorMessageLocale{
+			VN: "Quá thời gian thanh toán",
+			EN: "Transaction timeout",
+		},
+		Status:    StatusExpired,
+		Retryable: true,
+	},
+	"99": {
+		Code: "99",
+		Message: ErrorMessageLocale{
+			VN: "Người sử dụng hủy giao dịch",
+			EN: "User cancel",
+		},
+		Status:    StatusCancelled,
+		Retryable: true,
+	},
+}
+
+// LookupResponseCode finds code in the table of channel. An empty code
+// is pending. A code missing from the table is returned with
+// StatusUnknown, UnknownResponseMessage and ok set to false.
+func LookupResponseCode(channel Channel, code string) (rc ResponseCode, ok bool) {
+	if code == "" {
+		return pendingResponseCode, true
+	}
+
+	switch channel {
+	case ChannelDomestic:
+		rc, ok = DomesticResponseCodes[code]
+	case ChannelInternational:
+		rc, ok = InternationalResponseCodes[code]
+	}
+
+	if !ok {
+		rc = ResponseCode{Code: code, Message: UnknownResponseMessage, Status: StatusUnknown}
+	}
+
+	return rc, ok
+}
+
+func responseMessage(channel Channel, code string) ErrorMessageLocale {
+	rc, _ := LookupResponseCode(channel, code)
+	return rc.Message
+}
+
+// ResponseCode ...Tra cứu mã lỗi của cổng nội địa
+func (op *OnePayDomestic) ResponseCode(code string) (ResponseCode, bool) {
+	return LookupResponseCode(ChannelDomestic, code)
+}
+
+// ResponseCode ...Tra cứu mã lỗi của cổng quốc tế
+func (op *OnePayInternational) ResponseCode(code string) (ResponseCode, bool) {
+	return LookupResponseCode(ChannelInternational, code)
+}
@@ -0,0 +1,56 @@
+package payment
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResponseCodes(t *testing.T) {
+	Convey("Response codes", t, func() {
+		Convey("each channel has its own table", func() {
+			rc, ok := LookupResponseCode(ChannelInternational, "I")
+			So(ok, ShouldBeTrue)
+			So(rc.Code, ShouldEqual, "I")
+			So(rc.Status, ShouldEqual, StatusDeclined)
+
+			rc, ok = LookupResponseCode(ChannelDomestic, "I")
+			So(ok, ShouldBeFalse)
+			So(rc.Code, ShouldEqual, "I")
+			So(rc.Status, ShouldEqual, StatusUnknown)
+			So(rc.Message, ShouldResemble, UnknownResponseMessage)
+
+			dom, _ := LookupResponseCode(ChannelDomestic, "5")
+			intl, _ := LookupResponseCode(ChannelInternational, "5")
+			So(dom.Message.EN, ShouldEqual, "Invalid amount")
+			So(intl.Message.EN, ShouldEqual, "Insufficient funds")
+		})
+
+		Convey("covers the MIGS codes", func() {
+			for _, code := range []string{"2", "3", "4", "5", "6", "7", "A", "C", "D", "I", "L", "M", "N", "P", "R", "S", "T", "U", "V"} {
+				_, ok := LookupResponseCode(ChannelInternational, code)
+				So(ok, ShouldBeTrue)
+			}
+		})
+
+		Convey("sets Code in the table entries", func() {
+			for code, rc := range DomesticResponseCodes {
+				So(rc.Code, ShouldEqual, code)
+			}
+			for code, rc := range InternationalResponseCodes {
+				So(rc.Code, ShouldEqual, code)
+			}
+		})
+
+		Convey("is used by PostProcess", func() {
+			resp := &InternationalResponse{VPCTxnResponseCode: "U"}
+			resp.PostProcess()
+			So(resp.TxnResponseMessage.EN, ShouldEqual, "Card security code failed")
+
+			dom := &DomesticResponse{VPCTxnResponseCode: "U"}
+			dom.PostProcess()
+			So(dom.TxnResponseMessage, ShouldResemble, UnknownResponseMessage)
+			So(dom.Status(), ShouldEqual, StatusUnknown)
+		})
+	})
+}
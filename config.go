@@ -0,0 +1,150 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/go-playground/validator.v9"
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is prepended to the upper cased yaml name of a Config field,
+// e.g. ONEPAY_SECURE_SECRET overrides secure_secret.
+const EnvPrefix = "ONEPAY_"
+
+// LoadConfig reads a YAML (.yaml, .yml) or JSON (.json) file, applies the
+// ONEPAY_* environment overrides and validates the result.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, cfg)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format, use .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return loadEnv(cfg)
+}
+
+// LoadConfigFromEnv builds a Config from ONEPAY_* environment variables only.
+func LoadConfigFromEnv() (*Config, error) {
+	return loadEnv(&Config{})
+}
+
+func loadEnv(cfg *Config) (*Config, error) {
+	cfg.applyEnv(os.LookupEnv)
+
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnv overrides every string or []string field having a yaml name,
+// a []string is read as a comma separated list.
+func (cfg *Config) applyEnv(lookup func(key string) (string, bool)) {
+	rv := reflect.ValueOf(cfg).Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		name := yamlName(rt.Field(i))
+		if name == "" {
+			continue
+		}
+
+		value, ok := lookup(EnvPrefix + strings.ToUpper(name))
+		if !ok {
+			continue
+		}
+
+		switch field := rv.Field(i); field.Interface().(type) {
+		case string:
+			field.SetString(value)
+		case []string:
+			var list []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			field.Set(reflect.ValueOf(list))
+		}
+	}
+}
+
+func yamlName(f reflect.StructField) string {
+	name := strings.SplitN(f.Tag.Get("yaml"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// Validate runs the validate tags of Config and checks SecureSecret is
+// hex encoded. The returned error is a *ConfigError.
+func (cfg *Config) Validate() error {
+	if cfg == nil {
+		return &ConfigError{Fields: []FieldError{{Field: "config", Tag: "required", Message: "is nil"}}}
+	}
+
+	v := validator.New()
+	v.RegisterTagNameFunc(yamlName)
+
+	var fields []FieldError
+
+	err := v.Struct(cfg)
+	if verrs, ok := err.(validator.ValidationErrors); ok {
+		for _, fe := range verrs {
+			fields = append(fields, FieldError{
+				Field:   fe.Field(),
+				Tag:     fe.Tag(),
+				Message: validationMessage(fe),
+			})
+		}
+	} else if err != nil {
+		return err
+	}
+
+	checkHex := func(field, secret string) {
+		if _, err := hex.DecodeString(secret); secret != "" && err != nil {
+			fields = append(fields, FieldError{
+				Field:   field,
+				Tag:     "hex",
+				Message: "must be hex encoded",
+			})
+		}
+	}
+
+	checkHex("secure_secret", cfg.SecureSecret)
+	for i, secret := range cfg.VerificationSecrets {
+		checkHex(fmt.Sprintf("verification_secrets[%d]", i), secret)
+	}
+
+	if len(fields) > 0 {
+		return &ConfigError{Fields: fields}
+	}
+
+	return nil
+}
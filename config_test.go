@@ -0,0 +1,161 @@
+package payment
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfig(t *testing.T) {
+	Convey("Config", t, func() {
+		dir, err := ioutil.TempDir("", "onepay")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		write := func(name, content string) string {
+			path := filepath.Join(dir, name)
+			So(ioutil.WriteFile(path, []byte(content), 0600), ShouldBeNil)
+			return path
+		}
+
+		Convey("loads YAML with env overrides", func() {
+			path := write("onepay.yaml", `
+payment_gateway_host: mtf.onepay.vn
+payment_gateway_path: onecomm-pay/vpc.op
+query_dr_path: onecomm-pay/Vpcdps.op
+merchant: ONEPAY
+access_code: D67342C2
+return_url: https://example.com/callback
+secure_secret: A3EFDFABA8653DF2342E8DAC29B51AF0
+user: op01
+`)
+			os.Setenv("ONEPAY_PASSWORD", "op123456")
+			defer os.Unsetenv("ONEPAY_PASSWORD")
+			os.Setenv("ONEPAY_VERIFICATION_SECRETS", "6D0870CDE5F24F34F3915FB0045120DB, 00112233445566778899AABBCCDDEEFF")
+			defer os.Unsetenv("ONEPAY_VERIFICATION_SECRETS")
+
+			cfg, err := LoadConfig(path)
+			So(err, ShouldBeNil)
+			So(cfg.Merchant, ShouldEqual, "ONEPAY")
+			So(cfg.Password, ShouldEqual, "op123456")
+			So(cfg.VerificationSecrets, ShouldResemble, []string{
+				"6D0870CDE5F24F34F3915FB0045120DB",
+				"00112233445566778899AABBCCDDEEFF",
+			})
+		})
+
+		Convey("loads JSON", func() {
+			path := write("onepay.json", `{
+	"payment_gateway_host": "mtf.onepay.vn",
+	"payment_gateway_path": "vpcpay/vpcpay.op",
+	"query_dr_path": "vpcpay/Vpcdps.op",
+	"merchant": "TESTONEPAY",
+	"access_code": "6BEB2546",
+	"return_url": "https://example.com/callback",
+	"secure_secret": "6D0870CDE5F24F34F3915FB0045120DB",
+	"user": "op01",
+	"password": "op123456"
+}`)
+
+			cfg, err := LoadConfig(path)
+			So(err, ShouldBeNil)
+			So(cfg.Merchant, ShouldEqual, "TESTONEPAY")
+		})
+
+		Convey("reports every invalid field", func() {
+			path := write("onepay.yml", `
+payment_gateway_host: mtf.onepay.vn
+merchant: ONEPAY
+secure_secret: not-hex
+`)
+
+			_, err := LoadConfig(path)
+			So(err, ShouldHaveSameTypeAs, &ConfigError{})
+			So(errors.Is(err, ErrValidation), ShouldBeTrue)
+
+			fields := map[string]string{}
+			for _, f := range err.(*ConfigError).Fields {
+				fields[f.Field] = f.Tag
+			}
+			So(fields, ShouldResemble, map[string]string{
+				"payment_gateway_path": "required",
+				"access_code":          "required",
+				"return_url":           "required",
+				"query_dr_path":        "required",
+				"user":                 "required",
+				"password":             "required",
+				"secure_secret":        "hex",
+			})
+		})
+
+		Convey("is validated by the constructors", func() {
+			cfg := NewSandboxDomestic("https://example.com/callback").Cfg
+			cfg.User = "op01"
+			cfg.Password = "op123456"
+
+			op, err := NewDomestic(cfg)
+			So(err, ShouldBeNil)
+			So(op.Cfg, ShouldEqual, cfg)
+
+			cfg.SecureSecret = "not-hex"
+			cfg.ReturnURL = ""
+
+			_, err = NewDomestic(cfg)
+			So(err, ShouldHaveSameTypeAs, &ConfigError{})
+			So(err.(*ConfigError).Fields, ShouldHaveLength, 2)
+
+			_, err = NewInternational(cfg)
+			So(errors.Is(err, ErrValidation), ShouldBeTrue)
+		})
+
+		Convey("rejects unknown keys", func() {
+			path := write("onepay.yaml", "secure_secrett: A3EF\n")
+
+			_, err := LoadConfig(path)
+			So(err, ShouldNotBeNil)
+
+			path = write("onepay.json", `{"secure_secrett": "A3EF"}`)
+
+			_, err = LoadConfig(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "secure_secrett")
+		})
+
+		Convey("rejects a nil config", func() {
+			var cfg *Config
+			So(cfg.Validate(), ShouldNotBeNil)
+
+			_, err := NewDomestic(nil)
+			So(errors.Is(err, ErrNilConfig), ShouldBeTrue)
+
+			_, err = NewInternational(nil)
+			So(errors.Is(err, ErrNilConfig), ShouldBeTrue)
+
+			params := &CheckoutParams{
+				Money:       Money{Amount: 100000, Currency: "VND"},
+				OrderInfo:   "order 1",
+				MerchTxnRef: "ref-1",
+				TicketNo:    "127.0.0.1",
+				Title:       "Checkout",
+				AgainLink:   "https://example.com/cart",
+			}
+
+			dom := &OnePayDomestic{}
+			_, err = dom.BuildCheckoutURL(params)
+			So(errors.Is(err, ErrNilConfig), ShouldBeTrue)
+			_, err = dom.HandleCallback(url.Values{})
+			So(errors.Is(err, ErrNilConfig), ShouldBeTrue)
+
+			intl := &OnePayInternational{}
+			_, err = intl.BuildCheckoutURL(params)
+			So(errors.Is(err, ErrNilConfig), ShouldBeTrue)
+			_, err = intl.HandleCallback(url.Values{})
+			So(errors.Is(err, ErrNilConfig), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,135 @@
+// Package echoonepay registers the checkout, return and IPN routes of a
+// payment.Gateway on Echo, see payment.Handlers for how they behave.
+//
+//	g := e.Group("/payment/domestic")
+//	echoonepay.Register(g, op, echoonepay.Options{
+//		Resolve: resolveOrder,
+//		Success: renderReceipt,
+//		Fulfil:  fulfil,
+//	})
+package echoonepay
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/tranduythanh/payment"
+)
+
+// Options are the hooks of the routes.
+type Options struct {
+	// Resolve returns the checkout of the order of the request, TicketNo
+	// defaults to c.RealIP(). The checkout route is only registered with it.
+	Resolve func(c echo.Context) (*payment.CheckoutParams, error)
+	// Success renders an approved payment, defaults to the result as JSON
+	Success func(c echo.Context, result *payment.PaymentResult) error
+	// Failure renders a failed checkout or callback, result is nil when the
+	// request was rejected. Defaults to an *echo.HTTPError with
+	// payment.HTTPStatus.
+	Failure func(c echo.Context, result *payment.PaymentResult, err error) error
+	// AlreadyProcessed renders a replayed callback with the first result,
+	// defaults to the result as JSON
+	AlreadyProcessed func(c echo.Context, result *payment.PaymentResult) error
+	// Fulfil is called by the return or IPN route that settles the
+	// transaction, ONEPAY retries the IPN until it succeeds. The IPN route
+	// is only registered with it.
+	Fulfil func(result *payment.PaymentResult) error
+
+	// RoutePaths default to the payment.Default*Path
+	payment.RoutePaths
+}
+
+// Router is an *echo.Echo or an *echo.Group.
+type Router interface {
+	Match(methods []string, path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) []*echo.Route
+}
+
+// Register adds the routes of gw to r.
+func Register(r Router, gw payment.Gateway, opts Options) {
+	for _, route := range handlers(gw, opts).Routes(opts.RoutePaths) {
+		r.Match(route.Methods, route.Path, wrap(route.Handler))
+	}
+}
+
+// Checkout resolves the order of the request and redirects to ONEPAY.
+func Checkout(gw payment.Gateway, opts Options) echo.HandlerFunc {
+	return wrap(handlers(gw, opts).Checkout())
+}
+
+// Callback handles the ReturnURL, from the query or a posted form.
+func Callback(gw payment.Gateway, opts Options) echo.HandlerFunc {
+	return wrap(handlers(gw, opts).Callback())
+}
+
+// IPN confirms the IPNs of gw to ONEPAY once fulfil succeeded.
+func IPN(gw payment.Gateway, fulfil func(result *payment.PaymentResult) error) echo.HandlerFunc {
+	return echo.WrapHandler(payment.NewHandlers(gw, nil).IPN(fulfil))
+}
+
+type contextKey struct{}
+
+// call is the echo.Context of a request and the error of its hook, which
+// the net/http renderers cannot return.
+type call struct {
+	c   echo.Context
+	err error
+}
+
+// wrap serves h with a call in the context of the request, for the hooks.
+func wrap(h http.Handler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cl := &call{c: c}
+		ctx := context.WithValue(c.Request().Context(), contextKey{}, cl)
+		h.ServeHTTP(c.Response(), c.Request().WithContext(ctx))
+		return cl.err
+	}
+}
+
+func callOf(r *http.Request) *call {
+	return r.Context().Value(contextKey{}).(*call)
+}
+
+// handlers adapts the hooks of opts to payment.Handlers.
+func handlers(gw payment.Gateway, opts Options) *payment.Handlers {
+	h := payment.NewHandlers(gw, nil)
+	h.Fulfil = opts.Fulfil
+
+	if opts.Resolve != nil {
+		h.Resolve = func(r *http.Request) (*payment.CheckoutParams, error) {
+			c := callOf(r).c
+			params, err := opts.Resolve(c)
+			if err == nil && params != nil && params.TicketNo == "" {
+				params.TicketNo = c.RealIP()
+			}
+			return params, err
+		}
+	}
+
+	if opts.Success != nil {
+		h.Success = func(w http.ResponseWriter, r *http.Request, result *payment.PaymentResult) {
+			cl := callOf(r)
+			cl.err = opts.Success(cl.c, result)
+		}
+	}
+
+	if opts.AlreadyProcessed != nil {
+		h.AlreadyProcessed = func(w http.ResponseWriter, r *http.Request, result *payment.PaymentResult) {
+			cl := callOf(r)
+			cl.err = opts.AlreadyProcessed(cl.c, result)
+		}
+	}
+
+	h.Failure = func(w http.ResponseWriter, r *http.Request, result *payment.PaymentResult, err error) {
+		cl := callOf(r)
+
+		if opts.Failure != nil {
+			cl.err = opts.Failure(cl.c, result, err)
+			return
+		}
+
+		cl.err = echo.NewHTTPError(payment.HTTPStatus(err), err.Error())
+	}
+
+	return h
+}
@@ -0,0 +1,134 @@
+package echoonepay
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tranduythanh/payment"
+	"github.com/tranduythanh/payment/onepaytest"
+)
+
+func TestRegister(t *testing.T) {
+	Convey("Register", t, func() {
+		gw := onepaytest.NewServer()
+		defer gw.Close()
+
+		op := payment.NewSandboxDomestic("https://example.com/payment/callback")
+		op.Cfg = gw.Configure(op.Cfg)
+		op.Store = payment.NewMemoryStore()
+
+		var fulfilled []*payment.PaymentResult
+		var handled error
+
+		e := echo.New()
+		e.HTTPErrorHandler = func(err error, c echo.Context) {
+			handled = err
+			e.DefaultHTTPErrorHandler(err, c)
+		}
+
+		opts := Options{
+			Resolve: func(c echo.Context) (*payment.CheckoutParams, error) {
+				ref := c.QueryParam("order")
+				if ref == "" {
+					return nil, payment.ErrTransactionNotFound
+				}
+				if ref == "none" {
+					return nil, nil
+				}
+				return &payment.CheckoutParams{
+					Money:       payment.Money{Amount: 100000, Currency: "VND"},
+					OrderInfo:   "order " + ref,
+					MerchTxnRef: ref,
+					Title:       "Checkout",
+					AgainLink:   "https://example.com/cart",
+				}, nil
+			},
+			Success: func(c echo.Context, result *payment.PaymentResult) error {
+				return c.String(http.StatusOK, "paid "+result.MerchTxnRef)
+			},
+			Fulfil: func(result *payment.PaymentResult) error {
+				fulfilled = append(fulfilled, result)
+				return nil
+			},
+		}
+		opts.ReturnPath = "/return"
+		Register(e.Group("/payment"), op, opts)
+
+		serve := func(req *http.Request) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		clientIP := "203.0.113.7"
+		checkout := func(ref string) *url.URL {
+			req := httptest.NewRequest(http.MethodGet, "/payment/checkout?order="+ref, nil)
+			req.Header.Set(echo.HeaderXRealIP, clientIP)
+
+			rec := serve(req)
+			So(rec.Code, ShouldEqual, http.StatusFound)
+
+			u, err := url.Parse(rec.Header().Get("Location"))
+			So(err, ShouldBeNil)
+			return u
+		}
+
+		Convey("the routes are mounted on the group with their paths", func() {
+			u := checkout("ref-1")
+			So(u.Query().Get("vpc_TicketNo"), ShouldEqual, "203.0.113.7")
+
+			v, err := gw.Pay(u.String())
+			So(err, ShouldBeNil)
+
+			rec := serve(httptest.NewRequest(http.MethodGet, "/payment/return?"+v.Encode(), nil))
+			So(rec.Body.String(), ShouldEqual, "paid ref-1")
+
+			rec = serve(httptest.NewRequest(http.MethodPost, "/payment/ipn?"+v.Encode(), nil))
+			So(rec.Body.String(), ShouldEqual, payment.IPNConfirmSuccess)
+			So(len(fulfilled), ShouldEqual, 1)
+
+			So(serve(httptest.NewRequest(http.MethodGet, "/payment/callback", nil)).Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("an IPv6 client checks out", func() {
+			clientIP = "2001:db8:85a3::8a2e:370:7334"
+			So(checkout("ref-3").Query().Get("vpc_TicketNo"), ShouldEqual, clientIP)
+		})
+
+		Convey("no checkout from Resolve is not found", func() {
+			rec := serve(httptest.NewRequest(http.MethodGet, "/payment/checkout?order=none", nil))
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("a failure goes to the HTTPErrorHandler as an *echo.HTTPError", func() {
+			rec := serve(httptest.NewRequest(http.MethodGet, "/payment/checkout", nil))
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+
+			var herr *echo.HTTPError
+			So(errors.As(handled, &herr), ShouldBeTrue)
+			So(herr.Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("the error of a hook is returned to Echo", func() {
+			boom := errors.New("template missing")
+			e.GET("/custom", Callback(op, Options{
+				Failure: func(c echo.Context, result *payment.PaymentResult, err error) error {
+					return boom
+				},
+			}))
+
+			gw.SetOutcome("ref-2", onepaytest.Declined)
+			v, err := gw.Pay(checkout("ref-2").String())
+			So(err, ShouldBeNil)
+
+			rec := serve(httptest.NewRequest(http.MethodGet, "/custom?"+v.Encode(), nil))
+			So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+			So(handled, ShouldEqual, boom)
+		})
+	})
+}
@@ -1,12 +1,259 @@
 package payment
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// Defines sentinel errors, every error made by the package either is one
+// of them or matches one with errors.Is. The errors of a TransactionStore,
+// Locker, SeenStore or OrderLookup are returned as they are, or wrapped
+// with %w, and LoadConfig and LoadFraudRules return the errors of reading
+// and parsing their file.
+var (
+	ErrNilConfig             = errors.New("Config is nil")
+	ErrInvalidSignature      = errors.New("Invalid secure_hash")
+	ErrMissingSecureHash     = errors.New("Missing secure_hash")
+	ErrMalformedAmount       = errors.New("Malformed amount")
+	ErrValidation            = errors.New("Validation failed")
+	ErrGatewayTransport      = errors.New("Gateway transport error")
+	ErrGatewayDecline        = errors.New("Gateway declined")
+	ErrAuthorizeNotSupported = errors.New("Authorize is not supported by domestic gateway")
+	ErrUnsupportedCurrency   = errors.New("Unsupported currency")
+	ErrAlreadyProcessed      = errors.New("Callback already processed")
+
+	// ErrOrderMismatch is matched by every *MismatchError, the others
+	// tell which field differs
+	ErrOrderMismatch     = errors.New("Callback does not match the order")
+	ErrMerchantMismatch  = errors.New("Merchant mismatch")
+	ErrAmountMismatch    = errors.New("Amount mismatch")
+	ErrCurrencyMismatch  = errors.New("Currency mismatch")
+	ErrOrderInfoMismatch = errors.New("OrderInfo mismatch")
+)
+
+// FieldError ...
+type FieldError struct {
+	// Field is the yaml/json name of a Config field, or the path of a
+	// params field such as Customer.Email
+	Field string
+	// Tag is the failed rule: required, max, hex, ...
+	Tag     string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// ValidationError lists every invalid field of a request params.
+// It matches ErrValidation.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return "Validation failed: " + joinFieldErrors(e.Fields)
+}
+
+// Is ...
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// ConfigError lists every invalid field of a Config.
+// It matches ErrValidation.
+type ConfigError struct {
+	Fields []FieldError
+}
+
+func (e *ConfigError) Error() string {
+	return "Invalid config: " + joinFieldErrors(e.Fields)
+}
+
+// Is ...
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// decodeError turns an error of the schema decoder into a *ValidationError.
+func decodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ValidationError{Fields: []FieldError{{Field: "callback", Tag: "decode", Message: err.Error()}}}
+}
+
+func joinFieldErrors(fields []FieldError) string {
+	msgs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		msgs = append(msgs, f.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AmountError is returned when a vpc_*Amount value sent by the gateway is
+// not an integer. It matches ErrMalformedAmount.
+type AmountError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *AmountError) Error() string {
+	return fmt.Sprintf("Malformed amount %s=%q", e.Field, e.Value)
+}
+
+// Is ...
+func (e *AmountError) Is(target error) bool {
+	return target == ErrMalformedAmount
+}
+
+// Unwrap ...
+func (e *AmountError) Unwrap() error {
+	return e.Err
+}
+
+// TransportError is returned when a gateway call fails before a response
+// could be decoded. It matches ErrGatewayTransport and unwraps to the
+// underlying error, e.g. context.DeadlineExceeded.
+type TransportError struct {
+	// Command is the vpc_Command sent: queryDR, refund, ...
+	Command string
+	// StatusCode is set when the gateway answered with a non 200 status
+	StatusCode int
+	Err        error
+}
+
+func (e *TransportError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("Gateway transport error: %s: status %d: %v", e.Command, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("Gateway transport error: %s: %v", e.Command, e.Err)
+}
+
+// Is ...
+func (e *TransportError) Is(target error) bool {
+	return target == ErrGatewayTransport
+}
+
+// Unwrap ...
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// MismatchError is returned when a signed callback carries another
+// value than the order, it matches ErrOrderMismatch and unwraps to the
+// sentinel of the field, e.g. ErrAmountMismatch.
+type MismatchError struct {
+	Field    string
+	Expected string
+	Actual   string
+	Err      error
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%v: %s is %q, expected %q", e.Err, e.Field, e.Actual, e.Expected)
+}
+
+// Is ...
+func (e *MismatchError) Is(target error) bool {
+	return target == ErrOrderMismatch
+}
+
+// Unwrap ...
+func (e *MismatchError) Unwrap() error {
+	return e.Err
+}
+
+// DeclineError is returned when the gateway answered with a
+// vpc_TxnResponseCode other than "0". It matches ErrGatewayDecline.
+type DeclineError struct {
+	Code    string
+	Message ErrorMessageLocale
+}
+
+func (e *DeclineError) Error() string {
+	return fmt.Sprintf("Gateway declined with code %s: %s", e.Code, e.Message.EN)
+}
+
+// Is ...
+func (e *DeclineError) Is(target error) bool {
+	return target == ErrGatewayDecline
+}
+
+func declineError(channel Channel, code string) error {
+	if code == "0" {
+		return nil
+	}
+	return &DeclineError{Code: code, Message: responseMessage(channel, code)}
+}
+
+// validateStruct runs the validate tags of params and turns failures
+// into a *ValidationError.
+func validateStruct(params interface{}) error {
+	if params == nil {
+		return &ValidationError{Fields: []FieldError{{Field: "params", Tag: "required", Message: "is required"}}}
+	}
+
+	err := validator.New().Struct(params)
+	if err == nil {
+		return nil
+	}
+
+	verrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		// nil pointer params
+		return &ValidationError{Fields: []FieldError{{Field: "params", Tag: "required", Message: err.Error()}}}
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		field := fe.StructNamespace()
+		if i := strings.Index(field, "."); i >= 0 {
+			field = field[i+1:]
+		}
+
+		fields = append(fields, FieldError{
+			Field:   field,
+			Tag:     fe.Tag(),
+			Message: validationMessage(fe),
+		})
+	}
+
+	return &ValidationError{Fields: fields}
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		return "must be at most " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "email":
+		return "must be an email"
+	default:
+		return "failed on " + fe.Tag()
+	}
+}
+
 // ErrorMessageLocale ...
 type ErrorMessageLocale struct {
 	VN string
 	EN string
 }
 
-// ErrorMap ...
+// ErrorMap mixes the codes of both channels and misses many
+// international ones.
+//
+// Deprecated: use LookupResponseCode, DomesticResponseCodes or
+// InternationalResponseCodes.
 var ErrorMap = map[string]ErrorMessageLocale{
 	"0": ErrorMessageLocale{
 		VN: "Giao dịch thành công",
@@ -7,25 +7,27 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/tranduythanh/payment"
+	"github.com/tranduythanh/payment/echoonepay"
 )
 
 var domesticPayment *payment.OnePayDomestic
 var internationalPayment *payment.OnePayInternational
 
 func main() {
-	domesticPayment = payment.NewSandboxDomestic(" https://6b3ea130.ngrok.io/payment/callback/domestic")
-	internationalPayment = payment.NewSandboxInternational(" https://6b3ea130.ngrok.io/payment/callback/international")
+	domesticPayment = payment.NewSandboxDomestic(" https://6b3ea130.ngrok.io/payment/domestic/callback")
+	internationalPayment = payment.NewSandboxInternational(" https://6b3ea130.ngrok.io/payment/international/callback")
 
 	// Echo instance
 	e := echo.New()
 
 	// Routes
 	e.GET("/", hello)
-	e.GET("/payment/checkout/domestic", checkoutDomestic)
-	e.GET("/payment/checkout/international", checkoutInternational)
-
-	e.GET("/payment/callback/domestic", callbackDomestic)
-	e.GET("/payment/callback/international", callbackInternational)
+	echoonepay.Register(e.Group("/payment/domestic"), domesticPayment, echoonepay.Options{
+		Resolve: resolveOrder,
+	})
+	echoonepay.Register(e.Group("/payment/international"), internationalPayment, echoonepay.Options{
+		Resolve: resolveOrder,
+	})
 
 	// Start server
 	e.Logger.Fatal(e.Start(":8081"))
@@ -49,8 +51,8 @@ func hello(c echo.Context) error {
   <body>
 
 	<h2>Checkout</h2>
-	<a class="btn btn-primary" href="/payment/checkout/domestic" role="button">Domestic</a>
-	<a class="btn btn-primary" href="/payment/checkout/international" role="button">International</a>
+	<a class="btn btn-primary" href="/payment/domestic/checkout" role="button">Domestic</a>
+	<a class="btn btn-primary" href="/payment/international/checkout" role="button">International</a>
 
     <!-- Optional JavaScript -->
     <!-- jQuery first, then Popper.js, then Bootstrap JS -->
@@ -62,54 +64,14 @@ func hello(c echo.Context) error {
 	`)
 }
 
-func checkoutDomestic(c echo.Context) error {
-	timeStr := fmt.Sprintf("%d", time.Now().UnixNano())
-	url, err := domesticPayment.BuildCheckoutURL(&payment.CheckoutParams{
-		Amount:      100000,
-		OrderInfo:   timeStr,
-		MerchTxnRef: timeStr,
-		TicketNo:    "::1",
-	})
-	if err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
-	}
-
-	fmt.Println(url)
-
-	return c.Redirect(http.StatusTemporaryRedirect, url)
-}
-
-func checkoutInternational(c echo.Context) error {
+// resolveOrder makes up an order, a real service looks it up
+func resolveOrder(c echo.Context) (*payment.CheckoutParams, error) {
 	timeStr := fmt.Sprintf("%d", time.Now().UnixNano())
-	url, err := internationalPayment.BuildCheckoutURL(&payment.CheckoutParams{
-		Amount:      100000,
+	return &payment.CheckoutParams{
+		Money:       payment.Money{Amount: 100000, Currency: "VND"},
 		OrderInfo:   timeStr,
 		MerchTxnRef: timeStr,
-		TicketNo:    "::1",
-	})
-	if err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
-	}
-
-	fmt.Println(url)
-
-	return c.Redirect(http.StatusTemporaryRedirect, url)
-}
-
-func callbackDomestic(c echo.Context) error {
-	v, err := domesticPayment.HandleCallback(c.QueryParams())
-	if err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
-	}
-
-	return c.JSON(http.StatusOK, &v)
-}
-
-func callbackInternational(c echo.Context) error {
-	v, err := internationalPayment.HandleCallback(c.QueryParams())
-	if err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
-	}
-
-	return c.JSON(http.StatusOK, &v)
+		Title:       "Checkout",
+		AgainLink:   "https://6b3ea130.ngrok.io/",
+	}, nil
 }
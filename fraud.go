@@ -0,0 +1,369 @@
+package payment
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FraudDecision ...
+type FraudDecision string
+
+// Defines the decisions of the fraud rules, from the mildest
+const (
+	FraudAccept FraudDecision = "accept"
+	FraudReview FraudDecision = "review"
+	FraudReject FraudDecision = "reject"
+)
+
+func (d FraudDecision) severity() int {
+	switch d {
+	case FraudReview:
+		return 1
+	case FraudReject:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// FraudCheck names what a FraudRule looks at.
+type FraudCheck string
+
+// Defines the checks of a FraudRule
+const (
+	// FraudCheckAVSMismatch hits when the address or the postcode does not match
+	FraudCheckAVSMismatch FraudCheck = "avs_mismatch"
+	// FraudCheckCSCMismatch hits when the card security code does not match
+	FraudCheckCSCMismatch FraudCheck = "csc_mismatch"
+	// FraudCheckNotAuthenticated hits when 3-D Secure did not authenticate
+	// the cardholder, AllowAttempted accepts attempted authentications
+	FraudCheckNotAuthenticated FraudCheck = "not_authenticated"
+	// FraudCheckRiskResult hits when vpc_RiskOverallResult is one of
+	// Values, REV and REJ by default
+	FraudCheckRiskResult FraudCheck = "risk_result"
+	// FraudCheckCountryMismatch hits when the country of the card, given
+	// by FraudEngine.BINCountry, differs from vpc_AVS_Country
+	FraudCheckCountryMismatch FraudCheck = "country_mismatch"
+	// FraudCheckVelocity hits when more than Limit callbacks share the
+	// card prefix within Window
+	FraudCheckVelocity FraudCheck = "velocity"
+)
+
+// DefaultCardPrefixLength is the BIN length used by the velocity and
+// country checks.
+const DefaultCardPrefixLength = 6
+
+// FraudRule ...
+type FraudRule struct {
+	Name   string        `yaml:"name" json:"name"`
+	Check  FraudCheck    `yaml:"check" json:"check"`
+	Action FraudDecision `yaml:"action" json:"action"`
+
+	// AllowAttempted is used by not_authenticated
+	AllowAttempted bool `yaml:"allow_attempted" json:"allow_attempted"`
+	// Values is used by risk_result
+	Values []string `yaml:"values" json:"values"`
+	// Limit and Window are used by velocity
+	Limit  int           `yaml:"limit" json:"limit"`
+	Window time.Duration `yaml:"window" json:"window"`
+}
+
+func (r FraudRule) validate() error {
+	switch r.Check {
+	case FraudCheckAVSMismatch, FraudCheckCSCMismatch, FraudCheckNotAuthenticated,
+		FraudCheckRiskResult, FraudCheckCountryMismatch:
+	case FraudCheckVelocity:
+		if r.Limit <= 0 || r.Window <= 0 {
+			return fmt.Errorf("Rule %q: velocity needs a positive limit and window", r.Name)
+		}
+	default:
+		return fmt.Errorf("Rule %q: unknown check %q", r.Name, r.Check)
+	}
+
+	switch r.Action {
+	case FraudReview, FraudReject:
+	default:
+		return fmt.Errorf("Rule %q: action must be review or reject, got %q", r.Name, r.Action)
+	}
+
+	return nil
+}
+
+// FraudHit is a rule matched by a response.
+type FraudHit struct {
+	Rule   string        `json:"rule"`
+	Action FraudDecision `json:"action"`
+	Reason string        `json:"reason"`
+}
+
+// FraudAssessment is the outcome of the rules on a response, Decision is
+// the most severe action of the hits, FraudAccept without hits.
+type FraudAssessment struct {
+	Decision FraudDecision `json:"decision"`
+	Hits     []FraudHit    `json:"hits,omitempty"`
+}
+
+// FraudEngine evaluates FraudRules on international callbacks. Velocity
+// is counted in memory, run a single instance or put the engine behind
+// a shared service.
+type FraudEngine struct {
+	Rules []FraudRule `yaml:"rules" json:"rules"`
+
+	// CardPrefixLength defaults to DefaultCardPrefixLength
+	CardPrefixLength int `yaml:"card_prefix_length" json:"card_prefix_length"`
+
+	// BINCountry returns the issuing country of a card prefix, in the same
+	// form as vpc_AVS_Country. Without it country_mismatch never hits.
+	BINCountry func(prefix string) (country string, ok bool) `yaml:"-" json:"-"`
+
+	mu       sync.Mutex
+	attempts map[string][]fraudAttempt
+	now      func() time.Time
+}
+
+// fraudAttempt is a payment counted by the velocity rules, key is its
+// MerchTxnRef and TransactionNo.
+type fraudAttempt struct {
+	key string
+	at  time.Time
+}
+
+// NewFraudEngine ...
+func NewFraudEngine(rules ...FraudRule) (*FraudEngine, error) {
+	e := &FraudEngine{Rules: rules}
+
+	err := e.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// LoadFraudRules reads a FraudEngine from a YAML file:
+//
+//	card_prefix_length: 6
+//	rules:
+//	  - name: cvv
+//	    check: csc_mismatch
+//	    action: reject
+//	  - name: card testing
+//	    check: velocity
+//	    limit: 5
+//	    window: 10m
+//	    action: review
+func LoadFraudRules(path string) (*FraudEngine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &FraudEngine{}
+
+	err = yaml.UnmarshalStrict(data, e)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	err = e.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return e, nil
+}
+
+// Validate checks every rule has a known check and a review or reject action.
+func (e *FraudEngine) Validate() error {
+	for _, rule := range e.Rules {
+		err := rule.validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate runs the rules on resp, it records resp for the velocity rules.
+// The browser return, a refresh and the IPN of a payment are counted once.
+func (e *FraudEngine) Evaluate(resp *InternationalResponse) *FraudAssessment {
+	prefix := e.cardPrefix(resp.VPCCardNum)
+
+	if prefix != "" && e.hasCheck(FraudCheckVelocity) {
+		e.record(prefix, resp.VPCMerchTxnRef+":"+resp.VPCTransactionNo)
+	}
+
+	assessment := &FraudAssessment{Decision: FraudAccept}
+
+	for _, rule := range e.Rules {
+		reason, hit := e.check(rule, resp, prefix)
+		if !hit {
+			continue
+		}
+
+		assessment.Hits = append(assessment.Hits, FraudHit{
+			Rule:   rule.Name,
+			Action: rule.Action,
+			Reason: reason,
+		})
+
+		if rule.Action.severity() > assessment.Decision.severity() {
+			assessment.Decision = rule.Action
+		}
+	}
+
+	return assessment
+}
+
+func (e *FraudEngine) check(rule FraudRule, resp *InternationalResponse, prefix string) (string, bool) {
+	switch rule.Check {
+	case FraudCheckAVSMismatch:
+		avs := resp.AVSResult
+		if avs.Address == CheckNoMatch || avs.PostCode == CheckNoMatch {
+			return "AVS " + avs.Code + ": " + avs.Message.EN, true
+		}
+
+	case FraudCheckCSCMismatch:
+		if resp.CSCResult.Result == CheckNoMatch {
+			return "CSC " + resp.CSCResult.Code + ": " + resp.CSCResult.Message.EN, true
+		}
+
+	case FraudCheckNotAuthenticated:
+		ok := resp.ThreeDS.Authenticated
+		if rule.AllowAttempted {
+			ok = resp.ThreeDS.LiabilityShift
+		}
+		if !ok {
+			return "3-D Secure " + string(resp.ThreeDS.Authentication), true
+		}
+
+	case FraudCheckRiskResult:
+		values := rule.Values
+		if len(values) == 0 {
+			values = []string{"REV", "REJ"}
+		}
+		for _, value := range values {
+			if strings.EqualFold(resp.VPCRiskOverallResult, value) {
+				return "Risk result " + resp.VPCRiskOverallResult, true
+			}
+		}
+
+	case FraudCheckCountryMismatch:
+		if e.BINCountry == nil || prefix == "" || resp.VPCAVSCountry == "" {
+			break
+		}
+		country, ok := e.BINCountry(prefix)
+		if ok && !strings.EqualFold(country, resp.VPCAVSCountry) {
+			return fmt.Sprintf("Card country %s, billing country %s", country, resp.VPCAVSCountry), true
+		}
+
+	case FraudCheckVelocity:
+		if prefix == "" {
+			break
+		}
+		if e.countSince(prefix, rule.Window) > rule.Limit {
+			return fmt.Sprintf("More than %d payments with card %s within %s", rule.Limit, prefix, rule.Window), true
+		}
+	}
+
+	return "", false
+}
+
+func (e *FraudEngine) hasCheck(check FraudCheck) bool {
+	for _, rule := range e.Rules {
+		if rule.Check == check {
+			return true
+		}
+	}
+	return false
+}
+
+// cardPrefix returns the leading digits of a masked card number such as
+// 400000xxxxxx0002, empty when they are missing.
+func (e *FraudEngine) cardPrefix(cardNum string) string {
+	n := e.CardPrefixLength
+	if n <= 0 {
+		n = DefaultCardPrefixLength
+	}
+
+	if len(cardNum) < n {
+		return ""
+	}
+
+	for _, c := range cardNum[:n] {
+		if c < '0' || c > '9' {
+			return ""
+		}
+	}
+
+	return cardNum[:n]
+}
+
+func (e *FraudEngine) clock() time.Time {
+	if e.now != nil {
+		return e.now()
+	}
+	return time.Now()
+}
+
+// record remembers the attempt key with prefix, unless it is already
+// counted, and drops the attempts older than the longest velocity window.
+func (e *FraudEngine) record(prefix, key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.attempts == nil {
+		e.attempts = map[string][]fraudAttempt{}
+	}
+
+	var window time.Duration
+	for _, rule := range e.Rules {
+		if rule.Check == FraudCheckVelocity && rule.Window > window {
+			window = rule.Window
+		}
+	}
+
+	now := e.clock()
+	since := now.Add(-window)
+
+	for p, attempts := range e.attempts {
+		kept := attempts[:0]
+		for _, attempt := range attempts {
+			if attempt.at.After(since) {
+				kept = append(kept, attempt)
+			}
+		}
+		if len(kept) == 0 {
+			delete(e.attempts, p)
+			continue
+		}
+		e.attempts[p] = kept
+	}
+
+	for _, attempt := range e.attempts[prefix] {
+		if attempt.key == key {
+			return
+		}
+	}
+	e.attempts[prefix] = append(e.attempts[prefix], fraudAttempt{key: key, at: now})
+}
+
+func (e *FraudEngine) countSince(prefix string, window time.Duration) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	since := e.clock().Add(-window)
+
+	count := 0
+	for _, attempt := range e.attempts[prefix] {
+		if attempt.at.After(since) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,144 @@
+package payment
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFraud(t *testing.T) {
+	Convey("Fraud rules", t, func() {
+		Convey("loads rules from YAML", func() {
+			dir, err := ioutil.TempDir("", "onepay")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "fraud.yaml")
+			So(ioutil.WriteFile(path, []byte(`
+card_prefix_length: 6
+rules:
+  - name: cvv
+    check: csc_mismatch
+    action: reject
+  - name: card testing
+    check: velocity
+    limit: 2
+    window: 10m
+    action: review
+`), 0600), ShouldBeNil)
+
+			e, err := LoadFraudRules(path)
+			So(err, ShouldBeNil)
+			So(e.Rules, ShouldHaveLength, 2)
+			So(e.Rules[1].Window, ShouldEqual, 10*time.Minute)
+
+			So(ioutil.WriteFile(path, []byte("rules:\n  - name: x\n    check: moon_phase\n    action: reject\n"), 0600), ShouldBeNil)
+			_, err = LoadFraudRules(path)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("keeps the most severe decision", func() {
+			e, err := NewFraudEngine(
+				FraudRule{Name: "avs", Check: FraudCheckAVSMismatch, Action: FraudReview},
+				FraudRule{Name: "cvv", Check: FraudCheckCSCMismatch, Action: FraudReject},
+				FraudRule{Name: "3ds", Check: FraudCheckNotAuthenticated, Action: FraudReview, AllowAttempted: true},
+				FraudRule{Name: "risk", Check: FraudCheckRiskResult, Action: FraudReview},
+			)
+			So(err, ShouldBeNil)
+
+			resp := &InternationalResponse{VPCAVSResultCode: "N", VPCCSCResultCode: "M", VPCCard: "VC", VPC3DSECI: "06"}
+			resp.PostProcess()
+
+			a := e.Evaluate(resp)
+			So(a.Decision, ShouldEqual, FraudReview)
+			So(a.Hits, ShouldHaveLength, 1)
+			So(a.Hits[0].Rule, ShouldEqual, "avs")
+
+			resp.VPCCSCResultCode = "N"
+			resp.VPCRiskOverallResult = "REV"
+			resp.VPC3DSECI = "07"
+			resp.PostProcess()
+
+			a = e.Evaluate(resp)
+			So(a.Decision, ShouldEqual, FraudReject)
+			So(a.Hits, ShouldHaveLength, 4)
+		})
+
+		Convey("compares card and billing countries", func() {
+			e, err := NewFraudEngine(FraudRule{Name: "country", Check: FraudCheckCountryMismatch, Action: FraudReview})
+			So(err, ShouldBeNil)
+			e.BINCountry = func(prefix string) (string, bool) {
+				return "USA", prefix == "400000"
+			}
+
+			a := e.Evaluate(&InternationalResponse{VPCCardNum: "400000xxxxxx0002", VPCAVSCountry: "VNM"})
+			So(a.Decision, ShouldEqual, FraudReview)
+
+			a = e.Evaluate(&InternationalResponse{VPCCardNum: "400000xxxxxx0002", VPCAVSCountry: "usa"})
+			So(a.Decision, ShouldEqual, FraudAccept)
+		})
+
+		Convey("counts velocity per card prefix", func() {
+			e, err := NewFraudEngine(FraudRule{Name: "velocity", Check: FraudCheckVelocity, Limit: 2, Window: time.Minute, Action: FraudReject})
+			So(err, ShouldBeNil)
+
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			e.now = func() time.Time { return now }
+
+			card := func(ref string) *InternationalResponse {
+				return &InternationalResponse{VPCCardNum: "512345xxxxxx0008", VPCMerchTxnRef: ref, VPCTransactionNo: "1"}
+			}
+			So(e.Evaluate(card("ref-1")).Decision, ShouldEqual, FraudAccept)
+			So(e.Evaluate(card("ref-2")).Decision, ShouldEqual, FraudAccept)
+			So(e.Evaluate(card("ref-3")).Decision, ShouldEqual, FraudReject)
+			So(e.Evaluate(&InternationalResponse{VPCCardNum: "400000xxxxxx0002", VPCMerchTxnRef: "ref-4"}).Decision, ShouldEqual, FraudAccept)
+
+			now = now.Add(2 * time.Minute)
+			So(e.Evaluate(card("ref-5")).Decision, ShouldEqual, FraudAccept)
+
+			Convey("drops the prefixes without recent payments", func() {
+				So(e.attempts, ShouldContainKey, "512345")
+				So(e.attempts, ShouldNotContainKey, "400000")
+			})
+		})
+
+		Convey("counts the return, a refresh and the IPN of a payment once", func() {
+			e, err := NewFraudEngine(FraudRule{Name: "velocity", Check: FraudCheckVelocity, Limit: 1, Window: time.Minute, Action: FraudReject})
+			So(err, ShouldBeNil)
+
+			resp := &InternationalResponse{VPCCardNum: "512345xxxxxx0008", VPCMerchTxnRef: "ref-1", VPCTransactionNo: "1"}
+			for i := 0; i < 3; i++ {
+				So(e.Evaluate(resp).Decision, ShouldEqual, FraudAccept)
+			}
+
+			other := &InternationalResponse{VPCCardNum: "512345xxxxxx0008", VPCMerchTxnRef: "ref-2", VPCTransactionNo: "2"}
+			So(e.Evaluate(other).Decision, ShouldEqual, FraudReject)
+		})
+
+		Convey("is evaluated by HandleCallback", func() {
+			op := NewSandboxInternational("https://example.com/callback")
+
+			v := url.Values{}
+			v.Set("vpc_MerchTxnRef", "ref-1")
+			v.Set("vpc_TxnResponseCode", "0")
+			v.Set("vpc_CSCResultCode", "N")
+			addSecureHash(&v, op.Cfg.SecureSecret)
+
+			resp, err := op.HandleCallback(v)
+			So(err, ShouldBeNil)
+			So(resp.Fraud, ShouldBeNil)
+
+			op.Fraud, err = NewFraudEngine(FraudRule{Name: "cvv", Check: FraudCheckCSCMismatch, Action: FraudReject})
+			So(err, ShouldBeNil)
+
+			resp, err = op.HandleCallback(v)
+			So(err, ShouldBeNil)
+			So(resp.Fraud.Decision, ShouldEqual, FraudReject)
+		})
+	})
+}
@@ -0,0 +1,141 @@
+package payment
+
+import (
+	"context"
+	"net/url"
+)
+
+// Channel ...
+type Channel string
+
+// Defines payment channels
+const (
+	ChannelDomestic      Channel = "domestic"
+	ChannelInternational Channel = "international"
+)
+
+// Gateway is the behaviour shared by OnePayDomestic and OnePayInternational,
+// so callers can keep a map of channels and treat them the same way.
+type Gateway interface {
+	Channel() Channel
+	BuildCheckoutURL(params *CheckoutParams) (string, error)
+	BuildCheckoutURLContext(ctx context.Context, params *CheckoutParams) (string, error)
+	HandleResult(v url.Values) (*PaymentResult, error)
+	HandleResultContext(ctx context.Context, v url.Values) (*PaymentResult, error)
+	QueryDR(ctx context.Context, request *QueryDRAPIRequest) (*QueryDRAPIResponse, error)
+}
+
+var (
+	_ Gateway = (*OnePayDomestic)(nil)
+	_ Gateway = (*OnePayInternational)(nil)
+)
+
+// PaymentResult is the channel independent view of a callback.
+// Channel specific fields stay reachable through Domestic or International,
+// only the one matching Channel is set.
+type PaymentResult struct {
+	Channel Channel `json:"channel"`
+
+	Command         string `json:"command"`
+	Version         string `json:"version"`
+	Locale          string `json:"locale"`
+	CurrencyCode    string `json:"currency_code"`
+	Merchant        string `json:"merchant"`
+	MerchTxnRef     string `json:"merch_txn_ref"`
+	OrderInfo       string `json:"order_info"`
+	Amount          int64  `json:"amount"`
+	Money           Money  `json:"money"`
+	TransactionNo   string `json:"transaction_no"`
+	AcqResponseCode string `json:"acq_response_code"`
+	AuthorizeID     string `json:"authorize_id"`
+	Card            string `json:"card"`
+	CardNum         string `json:"card_num"`
+	Message         string `json:"message"`
+	AdditionData    string `json:"addition_data"`
+
+	TxnResponseCode    string             `json:"txn_response_code"`
+	TxnResponseMessage ErrorMessageLocale `json:"txn_response_message"`
+
+	SecretFingerprint string `json:"secret_fingerprint"`
+
+	// Settled is true for the one callback that moved the transaction out
+	// of pending, see OnePayDomestic.HandleCallback
+	Settled bool `json:"settled"`
+
+	Domestic      *DomesticResponse      `json:"domestic,omitempty"`
+	International *InternationalResponse `json:"international,omitempty"`
+}
+
+// Approved ...
+func (r *PaymentResult) Approved() bool {
+	return r.TxnResponseCode == "0"
+}
+
+// Err returns a *DeclineError when the payment was not approved, nil otherwise.
+func (r *PaymentResult) Err() error {
+	return declineError(r.Channel, r.TxnResponseCode)
+}
+
+// Result ...
+func (r *DomesticResponse) Result() *PaymentResult {
+	return &PaymentResult{
+		Channel: ChannelDomestic,
+
+		Command:         r.VPCCommand,
+		Version:         r.VPCVersion,
+		Locale:          r.VPCLocale,
+		CurrencyCode:    r.VPCCurrencyCode,
+		Merchant:        r.VPCMerchant,
+		MerchTxnRef:     r.VPCMerchTxnRef,
+		OrderInfo:       r.VPCOrderInfo,
+		Amount:          r.VPCAmount,
+		Money:           r.Money,
+		TransactionNo:   r.VPCTransactionNo,
+		AcqResponseCode: r.VPCAcqResponseCode,
+		AuthorizeID:     r.VPCAuthorizeID,
+		Card:            r.VPCCard,
+		CardNum:         r.VPCCardNum,
+		Message:         r.VPCMessage,
+		AdditionData:    r.VPCAdditionData,
+
+		TxnResponseCode:    r.VPCTxnResponseCode,
+		TxnResponseMessage: r.TxnResponseMessage,
+
+		SecretFingerprint: r.SecretFingerprint,
+		Settled:           r.Settled,
+
+		Domestic: r,
+	}
+}
+
+// Result ...
+func (r *InternationalResponse) Result() *PaymentResult {
+	return &PaymentResult{
+		Channel: ChannelInternational,
+
+		Command:         r.VPCCommand,
+		Version:         r.VPCVersion,
+		Locale:          r.VPCLocale,
+		CurrencyCode:    r.VPCCurrencyCode,
+		Merchant:        r.VPCMerchant,
+		MerchTxnRef:     r.VPCMerchTxnRef,
+		OrderInfo:       r.VPCOrderInfo,
+		Amount:          r.VPCAmount,
+		Money:           r.Money,
+		TransactionNo:   r.VPCTransactionNo,
+		AcqResponseCode: r.VPCAcqResponseCode,
+		AuthorizeID:     r.VPCAuthorizeID,
+		Card:            r.VPCCard,
+		CardNum:         r.VPCCardNum,
+		Message:         r.VPCMessage,
+		AdditionData:    r.VPCAdditionData,
+
+		TxnResponseCode:    r.VPCTxnResponseCode,
+		TxnResponseMessage: r.TxnResponseMessage,
+
+		SecretFingerprint: r.SecretFingerprint,
+		Settled:           r.Settled,
+
+		International: r,
+	}
+}
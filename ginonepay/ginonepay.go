@@ -0,0 +1,120 @@
+// Package ginonepay registers the checkout, return and IPN routes of a
+// payment.Gateway on Gin, see payment.Handlers for how they behave.
+//
+//	g := r.Group("/payment/domestic")
+//	ginonepay.Register(g, op, ginonepay.Options{
+//		Resolve: resolveOrder,
+//		Success: renderReceipt,
+//		Fulfil:  fulfil,
+//	})
+package ginonepay
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tranduythanh/payment"
+)
+
+// Options are the hooks of the routes.
+type Options struct {
+	// Resolve returns the checkout of the order of the request, TicketNo
+	// defaults to c.ClientIP(). The checkout route is only registered with it.
+	Resolve func(c *gin.Context) (*payment.CheckoutParams, error)
+	// Success renders an approved payment, defaults to the result as JSON
+	Success func(c *gin.Context, result *payment.PaymentResult)
+	// Failure renders a failed checkout or callback, result is nil when the
+	// request was rejected. The error is added to c.Errors first. Defaults
+	// to the error as text with payment.HTTPStatus.
+	Failure func(c *gin.Context, result *payment.PaymentResult, err error)
+	// AlreadyProcessed renders a replayed callback with the first result,
+	// defaults to the result as JSON
+	AlreadyProcessed func(c *gin.Context, result *payment.PaymentResult)
+	// Fulfil is called by the return or IPN route that settles the
+	// transaction, ONEPAY retries the IPN until it succeeds. The IPN route
+	// is only registered with it.
+	Fulfil func(result *payment.PaymentResult) error
+
+	// RoutePaths default to the payment.Default*Path
+	payment.RoutePaths
+}
+
+// Register adds the routes of gw to r, a *gin.Engine or a *gin.RouterGroup.
+func Register(r gin.IRoutes, gw payment.Gateway, opts Options) {
+	for _, route := range handlers(gw, opts).Routes(opts.RoutePaths) {
+		r.Match(route.Methods, route.Path, wrap(route.Handler))
+	}
+}
+
+// Checkout resolves the order of the request and redirects to ONEPAY.
+func Checkout(gw payment.Gateway, opts Options) gin.HandlerFunc {
+	return wrap(handlers(gw, opts).Checkout())
+}
+
+// Callback handles the ReturnURL, from the query or a posted form.
+func Callback(gw payment.Gateway, opts Options) gin.HandlerFunc {
+	return wrap(handlers(gw, opts).Callback())
+}
+
+// IPN confirms the IPNs of gw to ONEPAY once fulfil succeeded.
+func IPN(gw payment.Gateway, fulfil func(result *payment.PaymentResult) error) gin.HandlerFunc {
+	return gin.WrapH(payment.NewHandlers(gw, nil).IPN(fulfil))
+}
+
+type contextKey struct{}
+
+// wrap serves h with c in the context of the request, for the hooks.
+func wrap(h http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), contextKey{}, c)
+		h.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+	}
+}
+
+func ginContext(r *http.Request) *gin.Context {
+	return r.Context().Value(contextKey{}).(*gin.Context)
+}
+
+// handlers adapts the hooks of opts to payment.Handlers.
+func handlers(gw payment.Gateway, opts Options) *payment.Handlers {
+	h := payment.NewHandlers(gw, nil)
+	h.Fulfil = opts.Fulfil
+
+	if opts.Resolve != nil {
+		h.Resolve = func(r *http.Request) (*payment.CheckoutParams, error) {
+			c := ginContext(r)
+			params, err := opts.Resolve(c)
+			if err == nil && params != nil && params.TicketNo == "" {
+				params.TicketNo = c.ClientIP()
+			}
+			return params, err
+		}
+	}
+
+	if opts.Success != nil {
+		h.Success = func(w http.ResponseWriter, r *http.Request, result *payment.PaymentResult) {
+			opts.Success(ginContext(r), result)
+		}
+	}
+
+	if opts.AlreadyProcessed != nil {
+		h.AlreadyProcessed = func(w http.ResponseWriter, r *http.Request, result *payment.PaymentResult) {
+			opts.AlreadyProcessed(ginContext(r), result)
+		}
+	}
+
+	h.Failure = func(w http.ResponseWriter, r *http.Request, result *payment.PaymentResult, err error) {
+		c := ginContext(r)
+		c.Error(err)
+
+		if opts.Failure != nil {
+			opts.Failure(c, result, err)
+			return
+		}
+
+		c.String(payment.HTTPStatus(err), err.Error())
+	}
+
+	return h
+}
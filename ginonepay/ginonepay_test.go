@@ -0,0 +1,135 @@
+package ginonepay
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tranduythanh/payment"
+	"github.com/tranduythanh/payment/onepaytest"
+)
+
+func TestRegister(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	Convey("Register", t, func() {
+		gw := onepaytest.NewServer()
+		defer gw.Close()
+
+		op := payment.NewSandboxInternational("https://example.com/payment/callback")
+		op.Cfg = gw.Configure(op.Cfg)
+		op.Store = payment.NewMemoryStore()
+
+		var fulfilled []*payment.PaymentResult
+		var ginErrors []*gin.Error
+
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Next()
+			ginErrors = c.Errors
+		})
+
+		opts := Options{
+			Resolve: func(c *gin.Context) (*payment.CheckoutParams, error) {
+				ref := c.Query("order")
+				if ref == "" {
+					return nil, payment.ErrTransactionNotFound
+				}
+				if ref == "none" {
+					return nil, nil
+				}
+				return &payment.CheckoutParams{
+					Money:       payment.Money{Amount: 1050, Currency: "USD"},
+					OrderInfo:   "order " + ref,
+					MerchTxnRef: ref,
+					Title:       "Checkout",
+					AgainLink:   "https://example.com/cart",
+				}, nil
+			},
+			Success: func(c *gin.Context, result *payment.PaymentResult) {
+				c.String(http.StatusOK, "paid "+result.MerchTxnRef)
+			},
+			Fulfil: func(result *payment.PaymentResult) error {
+				fulfilled = append(fulfilled, result)
+				return nil
+			},
+		}
+		opts.ReturnPath = "/return"
+		Register(r.Group("/payment"), op, opts)
+
+		serve := func(req *http.Request) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			return rec
+		}
+
+		clientIP := "203.0.113.7"
+		checkout := func(ref string) *url.URL {
+			req := httptest.NewRequest(http.MethodGet, "/payment/checkout?order="+ref, nil)
+			req.Header.Set("X-Forwarded-For", clientIP)
+
+			rec := serve(req)
+			So(rec.Code, ShouldEqual, http.StatusFound)
+
+			u, err := url.Parse(rec.Header().Get("Location"))
+			So(err, ShouldBeNil)
+			return u
+		}
+
+		Convey("the routes are mounted on the group with their paths", func() {
+			u := checkout("ref-1")
+			So(u.Query().Get("vpc_TicketNo"), ShouldEqual, "203.0.113.7")
+
+			v, err := gw.Pay(u.String())
+			So(err, ShouldBeNil)
+
+			rec := serve(httptest.NewRequest(http.MethodGet, "/payment/return?"+v.Encode(), nil))
+			So(rec.Body.String(), ShouldEqual, "paid ref-1")
+
+			rec = serve(httptest.NewRequest(http.MethodPost, "/payment/ipn?"+v.Encode(), nil))
+			So(rec.Body.String(), ShouldEqual, payment.IPNConfirmSuccess)
+			So(len(fulfilled), ShouldEqual, 1)
+
+			So(serve(httptest.NewRequest(http.MethodGet, "/payment/callback", nil)).Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("an IPv6 client checks out", func() {
+			clientIP = "2001:db8:85a3::8a2e:370:7334"
+			So(checkout("ref-3").Query().Get("vpc_TicketNo"), ShouldEqual, clientIP)
+		})
+
+		Convey("no checkout from Resolve is not found", func() {
+			rec := serve(httptest.NewRequest(http.MethodGet, "/payment/checkout?order=none", nil))
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("a failure is added to c.Errors", func() {
+			rec := serve(httptest.NewRequest(http.MethodGet, "/payment/checkout", nil))
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+			So(ginErrors, ShouldHaveLength, 1)
+			So(errors.Is(ginErrors[0].Err, payment.ErrTransactionNotFound), ShouldBeTrue)
+		})
+
+		Convey("the Failure hook gets the gin.Context", func() {
+			var failed error
+			r.GET("/custom", Callback(op, Options{
+				Failure: func(c *gin.Context, result *payment.PaymentResult, err error) {
+					failed = err
+					c.String(http.StatusOK, "try again")
+				},
+			}))
+
+			gw.SetOutcome("ref-2", onepaytest.Declined)
+			v, err := gw.Pay(checkout("ref-2").String())
+			So(err, ShouldBeNil)
+
+			rec := serve(httptest.NewRequest(http.MethodGet, "/custom?"+v.Encode(), nil))
+			So(rec.Body.String(), ShouldEqual, "try again")
+			So(errors.Is(failed, payment.ErrGatewayDecline), ShouldBeTrue)
+		})
+	})
+}
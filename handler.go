@@ -0,0 +1,309 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// OrderResolver returns the checkout of the order a request is for, from
+// a path or query parameter, the session, ... TicketNo defaults to the IP
+// of the client. No checkout and no error is ErrTransactionNotFound.
+type OrderResolver func(r *http.Request) (*CheckoutParams, error)
+
+// SuccessRenderer writes the page of an approved payment.
+type SuccessRenderer func(w http.ResponseWriter, r *http.Request, result *PaymentResult)
+
+// ReplayRenderer writes the page of a callback already processed, such as
+// a refresh of the return page, with the first result.
+type ReplayRenderer func(w http.ResponseWriter, r *http.Request, result *PaymentResult)
+
+// FailureRenderer writes the page of a failed checkout or callback. result
+// is set for a declined payment, err is then a *DeclineError, and nil when
+// the request was rejected, see HTTPStatus.
+type FailureRenderer func(w http.ResponseWriter, r *http.Request, result *PaymentResult, err error)
+
+// Handlers are the net/http handlers of the checkout and return routes of a
+// Gateway, they work with net/http, chi, gorilla/mux, ...
+//
+//	h := payment.NewHandlers(op, resolveOrder)
+//	h.Success = renderReceipt
+//	h.Fulfil = fulfil
+//	mux.Handle("/payment/checkout", h.Checkout())
+//	mux.Handle("/payment/callback", h.Callback())
+//	mux.Handle("/payment/ipn", h.IPN(h.Fulfil))
+type Handlers struct {
+	Gateway Gateway
+	// Resolve is required by Checkout
+	Resolve OrderResolver
+	// Success defaults to the result as JSON
+	Success SuccessRenderer
+	// Failure defaults to the error as text with HTTPStatus
+	Failure FailureRenderer
+	// AlreadyProcessed defaults to the result as JSON, Success and Failure
+	// are called once per callback when the Gateway has a Dedup
+	AlreadyProcessed ReplayRenderer
+	// Fulfil is called by the return route for the callback that settles
+	// the transaction, the IPN route calls it when the IPN settles it
+	Fulfil func(result *PaymentResult) error
+}
+
+// NewHandlers ...
+func NewHandlers(gw Gateway, resolve OrderResolver) *Handlers {
+	return &Handlers{Gateway: gw, Resolve: resolve}
+}
+
+// Defines the default paths of RoutePaths
+const (
+	DefaultCheckoutPath = "/checkout"
+	DefaultReturnPath   = "/callback"
+	DefaultIPNPath      = "/ipn"
+)
+
+// RoutePaths are the paths of the routes of Handlers, each defaults to its
+// Default*Path.
+type RoutePaths struct {
+	CheckoutPath string
+	ReturnPath   string
+	IPNPath      string
+}
+
+// Route is a route of Handlers, the adapters of the web frameworks
+// (echoonepay, ginonepay) register them as is.
+type Route struct {
+	Methods []string
+	Path    string
+	Handler http.Handler
+}
+
+// Routes returns the checkout route when Resolve is set, the return route,
+// and the IPN route when Fulfil is set. Every route accepts GET and POST,
+// the return route reads both the query and a posted form.
+func (h *Handlers) Routes(paths RoutePaths) []Route {
+	methods := []string{http.MethodGet, http.MethodPost}
+
+	var routes []Route
+
+	if h.Resolve != nil {
+		routes = append(routes, Route{methods, pathOr(paths.CheckoutPath, DefaultCheckoutPath), h.Checkout()})
+	}
+
+	routes = append(routes, Route{methods, pathOr(paths.ReturnPath, DefaultReturnPath), h.Callback()})
+
+	if h.Fulfil != nil {
+		routes = append(routes, Route{methods, pathOr(paths.IPNPath, DefaultIPNPath), h.IPN(h.Fulfil)})
+	}
+
+	return routes
+}
+
+func pathOr(path, fallback string) string {
+	if path == "" {
+		return fallback
+	}
+	return path
+}
+
+// Checkout resolves the order of the request and redirects to ONEPAY.
+func (h *Handlers) Checkout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checkoutURL, err := h.checkoutURL(r)
+		if err != nil {
+			h.failure(w, r, nil, err)
+			return
+		}
+
+		http.Redirect(w, r, checkoutURL, http.StatusFound)
+	})
+}
+
+func (h *Handlers) checkoutURL(r *http.Request) (string, error) {
+	params, err := h.Resolve(r)
+	if err != nil {
+		return "", err
+	}
+	if params == nil {
+		return "", ErrTransactionNotFound
+	}
+
+	if params.TicketNo == "" {
+		params.TicketNo = clientIP(r)
+	}
+
+	return h.Gateway.BuildCheckoutURLContext(r.Context(), params)
+}
+
+// Callback handles the ReturnURL: a payment approved goes to Success, a
+// declined or rejected one to Failure and a replayed callback to
+// AlreadyProcessed. Fulfil runs first when the callback settles the
+// transaction.
+func (h *Handlers) Callback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := h.result(r)
+		if errors.Is(err, ErrAlreadyProcessed) {
+			h.alreadyProcessed(w, r, result)
+			return
+		}
+		if err != nil {
+			h.failure(w, r, result, err)
+			return
+		}
+
+		h.success(w, r, result)
+	})
+}
+
+func (h *Handlers) result(r *http.Request) (*PaymentResult, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, &ValidationError{Fields: []FieldError{{Field: "query", Tag: "parse", Message: err.Error()}}}
+	}
+
+	result, err := processResult(r.Context(), h.Gateway, r.Form, h.Fulfil)
+	if err != nil {
+		return result, err
+	}
+
+	return result, result.Err()
+}
+
+// IPN confirms the IPNs of the Gateway to ONEPAY, fn is called for the IPN
+// that settles the transaction and the IPN is confirmed once it succeeded,
+// see OnePayDomestic.IPNHandler.
+func (h *Handlers) IPN(fn func(result *PaymentResult) error) http.Handler {
+	return ipnHandler(func(ctx context.Context, v url.Values) error {
+		_, err := processResult(ctx, h.Gateway, v, fn)
+		if errors.Is(err, ErrAlreadyProcessed) {
+			return nil
+		}
+
+		return err
+	})
+}
+
+// processResult handles the callback v of gw, fn is only called when it
+// settles the transaction.
+func processResult(ctx context.Context, gw Gateway, v url.Values, fn func(result *PaymentResult) error) (*PaymentResult, error) {
+	fulfil := func(result *PaymentResult) error {
+		if fn == nil {
+			return nil
+		}
+		result.Settled = true
+		return fn(result)
+	}
+
+	switch op := gw.(type) {
+	case *OnePayDomestic:
+		resp, err := op.processCallback(ctx, v, func(resp *DomesticResponse) error {
+			return fulfil(resp.Result())
+		})
+		if resp == nil {
+			return nil, err
+		}
+		return resp.Result(), err
+	case *OnePayInternational:
+		resp, err := op.processCallback(ctx, v, func(resp *InternationalResponse) error {
+			return fulfil(resp.Result())
+		})
+		if resp == nil {
+			return nil, err
+		}
+		return resp.Result(), err
+	}
+
+	result, err := gw.HandleResultContext(ctx, v)
+	if err != nil || !result.Settled {
+		return result, err
+	}
+
+	return result, fulfil(result)
+}
+
+// CallbackResult handles the callback v of gw for the return route of a
+// web framework. A payment not approved is returned with a *DeclineError,
+// a replayed callback with the first result and ErrAlreadyProcessed.
+func CallbackResult(ctx context.Context, gw Gateway, v url.Values) (*PaymentResult, error) {
+	result, err := gw.HandleResultContext(ctx, v)
+	if err != nil {
+		return result, err
+	}
+
+	return result, result.Err()
+}
+
+func (h *Handlers) success(w http.ResponseWriter, r *http.Request, result *PaymentResult) {
+	if h.Success != nil {
+		h.Success(w, r, result)
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+func writeJSON(w http.ResponseWriter, result *PaymentResult) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *Handlers) alreadyProcessed(w http.ResponseWriter, r *http.Request, result *PaymentResult) {
+	if h.AlreadyProcessed != nil {
+		h.AlreadyProcessed(w, r, result)
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+func (h *Handlers) failure(w http.ResponseWriter, r *http.Request, result *PaymentResult, err error) {
+	if h.Failure != nil {
+		h.Failure(w, r, result, err)
+		return
+	}
+
+	http.Error(w, err.Error(), HTTPStatus(err))
+}
+
+// HTTPStatus maps an error of the package to the status of a response:
+// 400 for invalid requests and callbacks, 404 for an unknown order, 402
+// for a declined payment, 502 when ONEPAY cannot be reached and 500
+// otherwise.
+func HTTPStatus(err error) int {
+	switch {
+	case err == nil, errors.Is(err, ErrAlreadyProcessed):
+		return http.StatusOK
+	case errors.Is(err, ErrValidation),
+		errors.Is(err, ErrInvalidSignature),
+		errors.Is(err, ErrMissingSecureHash),
+		errors.Is(err, ErrMalformedAmount),
+		errors.Is(err, ErrUnsupportedCurrency),
+		errors.Is(err, ErrAuthorizeNotSupported),
+		errors.Is(err, ErrOrderMismatch):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTransactionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrTransactionExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrGatewayDecline):
+		return http.StatusPaymentRequired
+	case errors.Is(err, ErrGatewayTransport):
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// clientIP is the host of r.RemoteAddr, put a proxy aware middleware in
+// front of the handlers when needed.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,214 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHandlers(t *testing.T) {
+	Convey("Handlers", t, func() {
+		op := NewSandboxDomestic("https://example.com/callback")
+		op.Dedup = NewDedup(NewMemorySeenStore(), time.Hour)
+
+		h := NewHandlers(op, func(r *http.Request) (*CheckoutParams, error) {
+			ref := r.URL.Query().Get("order")
+			if ref == "" {
+				return nil, ErrTransactionNotFound
+			}
+			if ref == "none" {
+				return nil, nil
+			}
+			return &CheckoutParams{
+				Money:       Money{Amount: 100000, Currency: "VND"},
+				OrderInfo:   "order " + ref,
+				MerchTxnRef: ref,
+				Title:       "Checkout",
+				AgainLink:   "https://example.com/cart",
+			}, nil
+		})
+
+		var rendered *PaymentResult
+		var failed error
+		h.Success = func(w http.ResponseWriter, r *http.Request, result *PaymentResult) {
+			rendered = result
+			w.WriteHeader(http.StatusOK)
+		}
+		h.Failure = func(w http.ResponseWriter, r *http.Request, result *PaymentResult, err error) {
+			rendered, failed = result, err
+			w.WriteHeader(HTTPStatus(err))
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/checkout", h.Checkout())
+		mux.Handle("/callback", h.Callback())
+
+		remoteAddr := "10.0.0.1:4321"
+		serve := func(target string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.RemoteAddr = remoteAddr
+			mux.ServeHTTP(rec, req)
+			return rec
+		}
+
+		callback := func(code string) string {
+			v := url.Values{}
+			v.Set("vpc_Command", "pay")
+			v.Set("vpc_Merchant", op.Cfg.Merchant)
+			v.Set("vpc_MerchTxnRef", "ref-1")
+			v.Set("vpc_TransactionNo", "1")
+			v.Set("vpc_Amount", "10000000")
+			v.Set("vpc_TxnResponseCode", code)
+			addSecureHash(&v, op.Cfg.SecureSecret)
+			return "/callback?" + v.Encode()
+		}
+
+		Convey("checkout redirects to ONEPAY", func() {
+			rec := serve("/checkout?order=ref-1")
+			So(rec.Code, ShouldEqual, http.StatusFound)
+
+			u, err := url.Parse(rec.Header().Get("Location"))
+			So(err, ShouldBeNil)
+			So(u.Query().Get("vpc_MerchTxnRef"), ShouldEqual, "ref-1")
+			So(u.Query().Get("vpc_TicketNo"), ShouldEqual, "10.0.0.1")
+
+			Convey("with the IPv6 of the client", func() {
+				remoteAddr = "[2001:db8:85a3::8a2e:370:7334]:4321"
+
+				rec := serve("/checkout?order=ref-1")
+				So(rec.Code, ShouldEqual, http.StatusFound)
+
+				u, err := url.Parse(rec.Header().Get("Location"))
+				So(err, ShouldBeNil)
+				So(u.Query().Get("vpc_TicketNo"), ShouldEqual, "2001:db8:85a3::8a2e:370:7334")
+			})
+		})
+
+		Convey("checkout reports the resolver error", func() {
+			rec := serve("/checkout")
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+			So(rendered, ShouldBeNil)
+			So(errors.Is(failed, ErrTransactionNotFound), ShouldBeTrue)
+
+			failed = nil
+			rec = serve("/checkout?order=none")
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+			So(errors.Is(failed, ErrTransactionNotFound), ShouldBeTrue)
+		})
+
+		Convey("an approved callback is rendered by Success", func() {
+			So(serve(callback("0")).Code, ShouldEqual, http.StatusOK)
+			So(failed, ShouldBeNil)
+			So(rendered.MerchTxnRef, ShouldEqual, "ref-1")
+
+			Convey("but a refresh of the page by AlreadyProcessed", func() {
+				var replayed *PaymentResult
+				h.AlreadyProcessed = func(w http.ResponseWriter, r *http.Request, result *PaymentResult) {
+					replayed = result
+					w.WriteHeader(http.StatusOK)
+				}
+
+				rendered = nil
+				So(serve(callback("0")).Code, ShouldEqual, http.StatusOK)
+				So(rendered, ShouldBeNil)
+				So(failed, ShouldBeNil)
+				So(replayed.MerchTxnRef, ShouldEqual, "ref-1")
+			})
+		})
+
+		Convey("a declined callback is rendered by Failure", func() {
+			So(serve(callback("1")).Code, ShouldEqual, http.StatusPaymentRequired)
+			So(rendered.TxnResponseCode, ShouldEqual, "1")
+
+			var decline *DeclineError
+			So(errors.As(failed, &decline), ShouldBeTrue)
+			So(decline.Code, ShouldEqual, "1")
+		})
+
+		Convey("a tampered callback is rejected", func() {
+			So(serve(strings.Replace(callback("0"), "vpc_Amount=10000000", "vpc_Amount=100", 1)).Code, ShouldEqual, http.StatusBadRequest)
+			So(rendered, ShouldBeNil)
+			So(errors.Is(failed, ErrInvalidSignature), ShouldBeTrue)
+		})
+
+		Convey("the default renderers write JSON and text", func() {
+			h.Success, h.Failure = nil, nil
+
+			rec := serve(callback("0"))
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Header().Get("Content-Type"), ShouldStartWith, "application/json")
+			So(rec.Body.String(), ShouldContainSubstring, `"merch_txn_ref":"ref-1"`)
+
+			rec = serve("/checkout")
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+			So(rec.Body.String(), ShouldContainSubstring, ErrTransactionNotFound.Error())
+		})
+
+		Convey("Routes lists the routes to register", func() {
+			fulfil := func(result *PaymentResult) error { return nil }
+
+			paths := func(routes []Route) []string {
+				var list []string
+				for _, route := range routes {
+					list = append(list, route.Path)
+				}
+				return list
+			}
+
+			h.Fulfil = fulfil
+			So(paths(h.Routes(RoutePaths{})), ShouldResemble, []string{DefaultCheckoutPath, DefaultReturnPath, DefaultIPNPath})
+
+			h.Fulfil = nil
+			So(paths(h.Routes(RoutePaths{ReturnPath: "/return"})), ShouldResemble, []string{DefaultCheckoutPath, "/return"})
+
+			h.Resolve = nil
+			routes := h.Routes(RoutePaths{})
+			So(paths(routes), ShouldResemble, []string{DefaultReturnPath})
+			So(routes[0].Methods, ShouldResemble, []string{http.MethodGet, http.MethodPost})
+
+			Convey("the return route reads a posted form", func() {
+				target, _ := url.Parse(callback("0"))
+
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(target.RawQuery))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				routes[0].Handler.ServeHTTP(rec, req)
+
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(rendered.MerchTxnRef, ShouldEqual, "ref-1")
+			})
+		})
+
+		Convey("the context of the request reaches the order lookup", func() {
+			type ctxKey struct{}
+			var seen []interface{}
+			op.Orders = OrderLookupFunc(func(ctx context.Context, merchTxnRef string) (*Order, error) {
+				seen = append(seen, ctx.Value(ctxKey{}))
+				return nil, ErrTransactionNotFound
+			})
+
+			withValue := func(target string) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, target, nil)
+				return req.WithContext(context.WithValue(req.Context(), ctxKey{}, "request"))
+			}
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, withValue(callback("0")))
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+
+			rec = httptest.NewRecorder()
+			h.IPN(func(result *PaymentResult) error { return nil }).ServeHTTP(rec, withValue(callback("0")))
+			So(rec.Body.String(), ShouldEqual, IPNConfirmFail)
+
+			So(seen, ShouldResemble, []interface{}{"request", "request"})
+		})
+	})
+}
@@ -1,10 +1,10 @@
 package payment
 
 import (
+	"context"
 	"fmt"
 	"net/url"
-
-	"gopkg.in/go-playground/validator.v9"
+	"strconv"
 )
 
 // OnePayInternational ...
@@ -17,6 +17,26 @@ type OnePayInternational struct {
 	Locale             string
 
 	Cfg *Config
+
+	// Store is optional, see TransactionStore
+	Store TransactionStore
+
+	// Orders is optional, when set HandleCallback rejects a callback whose
+	// merchant, amount, currency or order info differs from the order with
+	// a *MismatchError. OrdersFromStore uses Store.
+	Orders OrderLookup
+
+	// Dedup is optional, when set HandleCallback returns the first
+	// response with ErrAlreadyProcessed for a callback seen before
+	Dedup *Dedup
+
+	// Locker serializes the callbacks, IPNs and QueryDRs of a MerchTxnRef,
+	// an in-process MutexLocker shared by the clients when nil
+	Locker Locker
+
+	// Fraud is optional, when set HandleCallback fills
+	// InternationalResponse.Fraud
+	Fraud *FraudEngine
 }
 
 // NewSandboxInternational ...
@@ -24,7 +44,7 @@ func NewSandboxInternational(returnURL string) *OnePayInternational {
 	return &OnePayInternational{
 		Version:  2,
 		Currency: "VND",
-		Command:  "pay",
+		Command:  CommandPay,
 		Locale:   "vn",
 
 		Cfg: &Config{
@@ -40,21 +60,55 @@ func NewSandboxInternational(returnURL string) *OnePayInternational {
 }
 
 // NewInternational ...
-func NewInternational(cfg *Config) *OnePayInternational {
+// cfg is checked with Config.Validate, a nil cfg is ErrNilConfig
+func NewInternational(cfg *Config) (*OnePayInternational, error) {
+	if cfg == nil {
+		return nil, ErrNilConfig
+	}
+
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
 	return &OnePayInternational{
 		Version:  2,
 		Currency: "VND",
-		Command:  "pay",
+		Command:  CommandPay,
 		Locale:   "vn",
 
 		Cfg: cfg,
-	}
+	}, nil
+}
+
+// Channel ...
+func (op *OnePayInternational) Channel() Channel {
+	return ChannelInternational
 }
 
 // BuildCheckoutURL ...
 func (op *OnePayInternational) BuildCheckoutURL(params *CheckoutParams) (string, error) {
+	return op.BuildCheckoutURLContext(context.Background(), params)
+}
+
+// BuildCheckoutURLContext is BuildCheckoutURL with the context of the
+// request, used by the Store.
+func (op *OnePayInternational) BuildCheckoutURLContext(ctx context.Context, params *CheckoutParams) (string, error) {
+	if op.Cfg == nil {
+		return "", ErrNilConfig
+	}
 
-	err := validator.New().Struct(params)
+	err := validateStruct(params)
+	if err != nil {
+		return "", err
+	}
+
+	money, err := resolveMoney(params.Amount, params.Money, op.Currency)
+	if err != nil {
+		return "", err
+	}
+
+	amount, err := money.gatewayAmount()
 	if err != nil {
 		return "", err
 	}
@@ -63,8 +117,8 @@ func (op *OnePayInternational) BuildCheckoutURL(params *CheckoutParams) (string,
 
 	// Static params
 	v.Add("vpc_Version", fmt.Sprintf("%d", op.Version))
-	v.Add("vpc_Currency", op.Currency)
-	v.Add("vpc_Command", op.Command)
+	v.Add("vpc_Currency", money.Currency)
+	v.Add("vpc_Command", op.command(params))
 	v.Add("vpc_AccessCode", op.Cfg.AccessCode)
 	v.Add("vpc_Merchant", op.Cfg.Merchant)
 	v.Add("vpc_Locale", op.Locale)
@@ -73,41 +127,172 @@ func (op *OnePayInternational) BuildCheckoutURL(params *CheckoutParams) (string,
 	// checkout params
 	v.Add("vpc_MerchTxnRef", params.MerchTxnRef)
 	v.Add("vpc_OrderInfo", params.OrderInfo)
-	v.Add("vpc_Amount", fmt.Sprintf("%d00", params.Amount))
+	v.Add("vpc_Amount", strconv.FormatInt(amount, 10))
 	v.Add("vpc_TicketNo", params.TicketNo)
 
+	// customer, billing and shipping params
+	params.addOptionalParams(&v)
+
 	// Add SecureHash
-	addSecureHash(&v, op.Cfg.SecureSecret)
+	err = addSecureHash(&v, op.Cfg.SecureSecret)
+	if err != nil {
+		return "", err
+	}
 
 	v.Add("Title", params.Title)
 	v.Add("AgainLink", params.AgainLink)
 
 	// Gen full url
-	u := &url.URL{
-		Scheme:   "https",
-		Host:     op.Cfg.PaymentGatewayHost,
-		Path:     op.Cfg.PaymentGatewayPath,
-		RawQuery: v.Encode(),
+	u := op.Cfg.gatewayURL(op.Cfg.PaymentGatewayPath, v)
+
+	err = createTransaction(ctx, op.Store, ChannelInternational, money, params)
+	if err != nil {
+		return "", err
 	}
 
 	return u.String(), nil
 }
 
-// HandleCallback ...
+func (op *OnePayInternational) command(params *CheckoutParams) string {
+	if params.Authorize {
+		return CommandAuthorize
+	}
+	return op.Command
+}
+
+// HandleCallback ...Xử lý kết quả thanh toán ONEPAY trả về ReturnURL
+// - Callback đã xử lý (khi có Dedup) trả về kết quả lần đầu và ErrAlreadyProcessed
+// - Callback, IPN và QueryDR của cùng MerchTxnRef được xử lý tuần tự, xem Locker
+// - Settled chỉ đúng với callback chuyển giao dịch khỏi trạng thái chờ, chỉ giao hàng khi đó
 func (op *OnePayInternational) HandleCallback(v url.Values) (*InternationalResponse, error) {
+	return op.HandleCallbackContext(context.Background(), v)
+}
+
+// HandleCallbackContext is HandleCallback with the context of the request,
+// used by Orders, Locker, Dedup and Store.
+func (op *OnePayInternational) HandleCallbackContext(ctx context.Context, v url.Values) (*InternationalResponse, error) {
+	return op.processCallback(ctx, v, nil)
+}
+
+// processCallback verifies v then, holding the lock of its MerchTxnRef,
+// calls fn and settles it when this call moves it out of pending. Dedup
+// remembers the callback once fn succeeded.
+func (op *OnePayInternational) processCallback(ctx context.Context, v url.Values, fn func(resp *InternationalResponse) error) (*InternationalResponse, error) {
 	var resp = &InternationalResponse{}
-	err := handleCallback(v, op.Cfg.SecureSecret, resp)
+	fingerprint, err := handleCallback(v, op.Cfg, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyOrder(ctx, op.Orders, v)
 	if err != nil {
 		return nil, err
 	}
 
+	resp.SecretFingerprint = fingerprint
 	resp.PostProcess()
 
+	unlock, err := lockTransaction(ctx, op.Locker, resp.VPCMerchTxnRef)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if op.Dedup != nil {
+		seen, err := op.Dedup.load(ctx, resp.VPCMerchTxnRef, resp.VPCTransactionNo, resp)
+		if err != nil {
+			return nil, err
+		}
+		if seen {
+			return resp, ErrAlreadyProcessed
+		}
+	}
+
+	if op.Fraud != nil {
+		resp.Fraud = op.Fraud.Evaluate(resp)
+	}
+
+	resp.Settled, err = settleTransaction(ctx, op.Store, ChannelInternational, resp.VPCMerchTxnRef, resp.VPCTransactionNo, resp.VPCTxnResponseCode, func() error {
+		if fn == nil {
+			return nil
+		}
+		return fn(resp)
+	})
+	if err != nil {
+		return resp, err
+	}
+
+	if op.Dedup != nil {
+		// another instance may have won the race when Locker is per process
+		seen, err := op.Dedup.remember(ctx, resp.VPCMerchTxnRef, resp.VPCTransactionNo, resp)
+		if err != nil {
+			return nil, err
+		}
+		if seen {
+			return resp, ErrAlreadyProcessed
+		}
+	}
+
 	return resp, nil
 }
 
+// HandleResult ...
+// - Callback đã xử lý (khi có Dedup) trả về kết quả lần đầu và ErrAlreadyProcessed
+func (op *OnePayInternational) HandleResult(v url.Values) (*PaymentResult, error) {
+	return op.HandleResultContext(context.Background(), v)
+}
+
+// HandleResultContext is HandleResult with the context of the request.
+func (op *OnePayInternational) HandleResultContext(ctx context.Context, v url.Values) (*PaymentResult, error) {
+	resp, err := op.HandleCallbackContext(ctx, v)
+	if resp == nil {
+		return nil, err
+	}
+
+	return resp.Result(), err
+}
+
 // QueryDR ...Truy vấn trạng thái giao dịch (QueryDR API)
 // - Chỉ gọi hàm này sau 15 phút giao dịch, Phương thức là redirect, kiểu GET
-func (op *OnePayInternational) QueryDR(request *QueryDRAPIRequest) (res *QueryDRAPIResponse, err error) {
-	return queryDR(op.Cfg, request)
+func (op *OnePayInternational) QueryDR(ctx context.Context, request *QueryDRAPIRequest) (res *QueryDRAPIResponse, err error) {
+	res, err = queryDR(ctx, op.Cfg, ChannelInternational, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Exists() && op.Store != nil {
+		unlock, err := lockTransaction(ctx, op.Locker, request.VPCMerchTxnRef)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		res.settled, err = settleTransaction(ctx, op.Store, ChannelInternational, request.VPCMerchTxnRef, res.VPCTransactionNo, res.VPCTxnResponseCode, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// Refund ...Hoàn tiền giao dịch (Refund API)
+// - Hỗ trợ hoàn tiền một phần, Amount nhỏ hơn hoặc bằng số tiền đã thanh toán
+// - Cần Cfg.User và Cfg.Password do ONEPAY cung cấp
+// - Bị từ chối thì trả về cả response và *DeclineError
+func (op *OnePayInternational) Refund(ctx context.Context, params *RefundParams) (*RefundResponse, error) {
+	return refund(ctx, op.Cfg, ChannelInternational, op.Currency, params)
+}
+
+// Capture ...Thu tiền giao dịch đã authorize
+// - TransactionNo là vpc_TransactionNo của giao dịch authorize
+// - Có thể capture nhiều lần, tổng không vượt quá số tiền đã authorize
+// - Bị từ chối thì trả về cả response và *DeclineError
+func (op *OnePayInternational) Capture(ctx context.Context, params *CaptureParams) (*AuthorizationResponse, error) {
+	return capture(ctx, op.Cfg, op.Currency, params)
+}
+
+// Void ...Huỷ giao dịch authorize, trả lại phần tiền chưa capture
+func (op *OnePayInternational) Void(ctx context.Context, params *VoidParams) (*AuthorizationResponse, error) {
+	return void(ctx, op.Cfg, op.Currency, params)
 }
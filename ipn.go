@@ -0,0 +1,69 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Defines the acknowledgement bodies OnePay expects from an IPN url.
+// Any body other than IPNConfirmSuccess makes OnePay retry the notification.
+const (
+	IPNConfirmSuccess = "responsecode=1&desc=confirm-success"
+	IPNConfirmFail    = "responsecode=0&desc=confirm-fail"
+)
+
+// IPNHandler ...Xử lý IPN (server to server) từ ONEPAY
+// - vpc_SecureHash được kiểm tra trước khi gọi fn
+// - fn trả về lỗi thì ONEPAY sẽ gửi lại IPN
+// - fn chạy khi giữ khóa của MerchTxnRef, xem Locker
+// - fn chỉ được gọi cho IPN chuyển giao dịch khỏi trạng thái chờ, xem Settled
+// - IPN đã xử lý, kể cả sau ReturnURL (khi có Dedup), được xác nhận mà không gọi lại fn
+func (op *OnePayDomestic) IPNHandler(fn func(resp *DomesticResponse) error) http.Handler {
+	return ipnHandler(func(ctx context.Context, v url.Values) error {
+		_, err := op.processCallback(ctx, v, fn)
+		if errors.Is(err, ErrAlreadyProcessed) {
+			return nil
+		}
+
+		return err
+	})
+}
+
+// IPNHandler ...Xử lý IPN (server to server) từ ONEPAY
+// - vpc_SecureHash được kiểm tra trước khi gọi fn
+// - fn trả về lỗi thì ONEPAY sẽ gửi lại IPN
+// - fn chạy khi giữ khóa của MerchTxnRef, xem Locker
+// - fn chỉ được gọi cho IPN chuyển giao dịch khỏi trạng thái chờ, xem Settled
+// - IPN đã xử lý, kể cả sau ReturnURL (khi có Dedup), được xác nhận mà không gọi lại fn
+func (op *OnePayInternational) IPNHandler(fn func(resp *InternationalResponse) error) http.Handler {
+	return ipnHandler(func(ctx context.Context, v url.Values) error {
+		_, err := op.processCallback(ctx, v, fn)
+		if errors.Is(err, ErrAlreadyProcessed) {
+			return nil
+		}
+
+		return err
+	})
+}
+
+func ipnHandler(process func(ctx context.Context, v url.Values) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// OnePay sends the IPN as a GET, r.Form also covers form posts
+		err := r.ParseForm()
+		if err == nil {
+			err = process(r.Context(), r.Form)
+		}
+
+		ack := IPNConfirmSuccess
+		if err != nil {
+			ack = IPNConfirmFail
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, ack)
+	})
+}
@@ -0,0 +1,64 @@
+package payment
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIPN(t *testing.T) {
+	Convey("IPN", t, func() {
+		op := NewSandboxDomestic("https://example.com/callback")
+
+		v := url.Values{}
+		v.Set("vpc_Command", "pay")
+		v.Set("vpc_Merchant", op.Cfg.Merchant)
+		v.Set("vpc_MerchTxnRef", "ref-1")
+		v.Set("vpc_Amount", "10000000")
+		v.Set("vpc_TxnResponseCode", "0")
+		addSecureHash(&v, op.Cfg.SecureSecret)
+
+		serve := func(h http.Handler, v url.Values) string {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ipn?"+v.Encode(), nil))
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			return rec.Body.String()
+		}
+
+		Convey("confirms a valid notification", func() {
+			var got *DomesticResponse
+			h := op.IPNHandler(func(resp *DomesticResponse) error {
+				got = resp
+				return nil
+			})
+
+			So(serve(h, v), ShouldEqual, IPNConfirmSuccess)
+			So(got.VPCMerchTxnRef, ShouldEqual, "ref-1")
+			So(got.VPCAmount, ShouldEqual, 100000)
+		})
+
+		Convey("rejects a tampered notification", func() {
+			called := false
+			h := op.IPNHandler(func(resp *DomesticResponse) error {
+				called = true
+				return nil
+			})
+
+			v.Set("vpc_Amount", "100")
+			So(serve(h, v), ShouldEqual, IPNConfirmFail)
+			So(called, ShouldBeFalse)
+		})
+
+		Convey("asks for a retry when the callback fails", func() {
+			h := op.IPNHandler(func(resp *DomesticResponse) error {
+				return errors.New("db down")
+			})
+
+			So(serve(h, v), ShouldEqual, IPNConfirmFail)
+		})
+	})
+}
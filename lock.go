@@ -0,0 +1,103 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Locker serializes the work on one MerchTxnRef, the browser return and
+// the IPN of a payment usually arrive within milliseconds. Implement it
+// with a distributed lock (Redis, SELECT ... FOR UPDATE, ...) when
+// several instances share a TransactionStore.
+type Locker interface {
+	// Lock blocks until key is held or ctx is done, unlock releases it.
+	// ctx only bounds the wait, the lock is held until unlock.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// MutexLocker is an in-process Locker, one mutex per key held.
+type MutexLocker struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+// NewMutexLocker ...
+func NewMutexLocker() *MutexLocker {
+	return &MutexLocker{locks: map[string]*keyLock{}}
+}
+
+// defaultLocker is used by the clients and the Reconciler without a Locker,
+// so they serialize with each other in the same process.
+var defaultLocker = NewMutexLocker()
+
+// Lock ...
+func (l *MutexLocker) Lock(ctx context.Context, key string) (func(), error) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*keyLock{}
+	}
+	kl, ok := l.locks[key]
+	if !ok {
+		kl = &keyLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+
+	select {
+	case kl.ch <- struct{}{}:
+	case <-ctx.Done():
+		l.release(key, kl)
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-kl.ch
+			l.release(key, kl)
+		})
+	}, nil
+}
+
+// release drops the mutex of key once nobody holds or waits for it.
+func (l *MutexLocker) release(key string, kl *keyLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kl.refs--
+	if kl.refs == 0 {
+		delete(l.locks, key)
+	}
+}
+
+// DefaultLockTimeout bounds the wait for the lock of a MerchTxnRef when
+// the context has no deadline.
+const DefaultLockTimeout = 30 * time.Second
+
+// lockTransaction locks merchTxnRef with locker, or defaultLocker when nil.
+func lockTransaction(ctx context.Context, locker Locker, merchTxnRef string) (func(), error) {
+	if locker == nil {
+		locker = defaultLocker
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultLockTimeout)
+		defer cancel()
+	}
+
+	unlock, err := locker.Lock(ctx, "onepay:txn:"+merchTxnRef)
+	if err != nil {
+		return nil, fmt.Errorf("Lock %s: %w", merchTxnRef, err)
+	}
+
+	return unlock, nil
+}
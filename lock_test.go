@@ -0,0 +1,148 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingStore counts the updates and widens the window between Get and
+// Update, where an unlocked settle races.
+type countingStore struct {
+	*MemoryStore
+	updates int32
+}
+
+func (s *countingStore) Get(ctx context.Context, merchTxnRef string) (*Transaction, error) {
+	txn, err := s.MemoryStore.Get(ctx, merchTxnRef)
+	time.Sleep(time.Millisecond)
+	return txn, err
+}
+
+func (s *countingStore) Settle(ctx context.Context, txn *Transaction) (bool, error) {
+	atomic.AddInt32(&s.updates, 1)
+	return s.MemoryStore.Settle(ctx, txn)
+}
+
+func TestMutexLocker(t *testing.T) {
+	Convey("MutexLocker", t, func() {
+		l := NewMutexLocker()
+		ctx := context.Background()
+
+		unlock, err := l.Lock(ctx, "a")
+		So(err, ShouldBeNil)
+
+		Convey("does not block other keys", func() {
+			unlockB, err := l.Lock(ctx, "b")
+			So(err, ShouldBeNil)
+			unlockB()
+			unlock()
+		})
+
+		Convey("blocks the same key until unlocked", func() {
+			timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+
+			_, err := l.Lock(timeout, "a")
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+
+			unlock()
+			unlock()
+
+			unlock, err = l.Lock(ctx, "a")
+			So(err, ShouldBeNil)
+			unlock()
+
+			So(l.locks, ShouldBeEmpty)
+		})
+
+		Convey("gives up on a held lock after the deadline", func() {
+			timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+
+			unlockTxn, err := lockTransaction(timeout, l, "ref-1")
+			So(err, ShouldBeNil)
+
+			_, err = lockTransaction(timeout, l, "ref-1")
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			unlockTxn()
+			unlock()
+		})
+	})
+}
+
+func TestConcurrentCallbacks(t *testing.T) {
+	Convey("A browser return racing the IPN", t, func() {
+		store := &countingStore{MemoryStore: NewMemoryStore()}
+
+		op := NewSandboxDomestic("https://example.com/callback")
+		op.Store = store
+		op.Locker = NewMutexLocker()
+		op.Dedup = NewDedup(NewMemorySeenStore(), time.Hour)
+
+		_, err := op.BuildCheckoutURL(&CheckoutParams{
+			Money:       Money{Amount: 100000, Currency: "VND"},
+			OrderInfo:   "order 1",
+			MerchTxnRef: "ref-1",
+			TicketNo:    "127.0.0.1",
+			Title:       "Checkout",
+			AgainLink:   "https://example.com/cart",
+		})
+		So(err, ShouldBeNil)
+
+		v := url.Values{}
+		v.Set("vpc_Command", "pay")
+		v.Set("vpc_Merchant", op.Cfg.Merchant)
+		v.Set("vpc_MerchTxnRef", "ref-1")
+		v.Set("vpc_TransactionNo", "1")
+		v.Set("vpc_Amount", "10000000")
+		v.Set("vpc_TxnResponseCode", "0")
+		addSecureHash(&v, op.Cfg.SecureSecret)
+
+		var fulfilled int32
+		h := op.IPNHandler(func(resp *DomesticResponse) error {
+			atomic.AddInt32(&fulfilled, 1)
+			return nil
+		})
+
+		var wg sync.WaitGroup
+		var processed int32
+		for i := 0; i < 8; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				resp, err := op.HandleCallback(v)
+				if err == nil {
+					atomic.AddInt32(&processed, 1)
+				}
+				if resp != nil && resp.Settled {
+					atomic.AddInt32(&fulfilled, 1)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ipn?"+v.Encode(), nil))
+			}()
+		}
+		wg.Wait()
+
+		// the return settling it is fulfilled by its caller, the IPN by fn,
+		// and the later returns and IPNs are replays of the first callback
+		So(atomic.LoadInt32(&store.updates), ShouldEqual, 1)
+		So(atomic.LoadInt32(&fulfilled), ShouldEqual, 1)
+		So(atomic.LoadInt32(&processed), ShouldBeLessThanOrEqualTo, 1)
+
+		txn, err := store.Get(context.Background(), "ref-1")
+		So(err, ShouldBeNil)
+		So(txn.State, ShouldEqual, StateApproved)
+	})
+}
@@ -0,0 +1,197 @@
+package payment
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is assumed when neither the params nor the gateway
+// tell the currency.
+const DefaultCurrency = "VND"
+
+// gatewayExponent is the number of implied decimals of vpc_Amount,
+// 100000 VND is sent as 10000000 and 10.50 USD as 1050.
+const gatewayExponent = 2
+
+// maxGatewayAmount is the largest vpc_Amount, the limit of the deprecated
+// Amount fields (9999999999 whole units).
+const maxGatewayAmount int64 = 9999999999 * 100
+
+// currencyExponents are the ISO 4217 minor units of the currencies a
+// merchant may settle in. VND has no minor unit.
+var currencyExponents = map[string]int{
+	"VND": 0,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"AUD": 2,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"HKD": 2,
+	"NZD": 2,
+	"SGD": 2,
+	"THB": 2,
+	"MYR": 2,
+	"PHP": 2,
+	"IDR": 2,
+	"TWD": 2,
+	"KHR": 2,
+	"LAK": 2,
+	"JPY": 0,
+	"KRW": 0,
+}
+
+// CurrencyExponent returns the ISO 4217 minor units of currency, 2 for
+// USD and 0 for VND.
+func CurrencyExponent(currency string) (int, bool) {
+	exp, ok := currencyExponents[strings.ToUpper(currency)]
+	return exp, ok
+}
+
+// Money is an exact amount in the minor unit of an ISO 4217 currency:
+// Money{Amount: 1050, Currency: "USD"} is 10.50 USD and
+// Money{Amount: 100000, Currency: "VND"} is 100,000 VND.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// ParseMoney reads a decimal amount such as "10.5" in currency, more
+// decimals than the currency has is an error.
+func ParseMoney(s, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	exp, ok := CurrencyExponent(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrUnsupportedCurrency, currency)
+	}
+
+	s = strings.TrimSpace(s)
+	whole, frac := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+
+	if len(frac) > exp {
+		return Money{}, &AmountError{Field: "amount", Value: s, Err: fmt.Errorf("%s has %d decimals", currency, exp)}
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, &AmountError{Field: "amount", Value: s, Err: err}
+	}
+	if amount <= 0 {
+		return Money{}, &AmountError{Field: "amount", Value: s, Err: fmt.Errorf("must be greater than 0")}
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// String formats m with the decimals of its currency: "10.50 USD".
+func (m Money) String() string {
+	exp, ok := CurrencyExponent(m.Currency)
+	if !ok || exp == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+
+	pow := pow10(exp)
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/pow, exp, amount%pow, m.Currency)
+}
+
+// gatewayAmount converts m to vpc_Amount, m must be within 1 and
+// maxGatewayAmount once converted.
+func (m Money) gatewayAmount() (int64, error) {
+	exp, ok := CurrencyExponent(m.Currency)
+	if !ok || exp > gatewayExponent {
+		return 0, fmt.Errorf("%w %q", ErrUnsupportedCurrency, m.Currency)
+	}
+
+	scale := pow10(gatewayExponent - exp)
+	if m.Amount <= 0 {
+		return 0, &ValidationError{Fields: []FieldError{{Field: "Money.Amount", Tag: "gt", Message: "must be greater than 0"}}}
+	}
+	if m.Amount > maxGatewayAmount/scale {
+		return 0, &ValidationError{Fields: []FieldError{{Field: "Money.Amount", Tag: "lte", Message: fmt.Sprintf("must be at most %d", maxGatewayAmount/scale)}}}
+	}
+
+	return m.Amount * scale, nil
+}
+
+// moneyFromGateway converts a vpc_Amount, checkAmounts has made sure it
+// has no decimals the currency cannot hold.
+func moneyFromGateway(amount int64, currency string) Money {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	currency = strings.ToUpper(currency)
+
+	exp, ok := CurrencyExponent(currency)
+	if !ok || exp > gatewayExponent {
+		exp = 0
+	}
+
+	return Money{Amount: amount / pow10(gatewayExponent-exp), Currency: currency}
+}
+
+// resolveMoney picks money, or amount in whole units of currency for
+// params still using the deprecated Amount field.
+func resolveMoney(amount int64, money Money, currency string) (Money, error) {
+	if money.Amount == 0 && money.Currency == "" {
+		if amount <= 0 {
+			return Money{}, &ValidationError{Fields: []FieldError{{Field: "Money", Tag: "required", Message: "is required"}}}
+		}
+
+		exp, ok := CurrencyExponent(currency)
+		if !ok {
+			return Money{}, fmt.Errorf("%w %q", ErrUnsupportedCurrency, currency)
+		}
+
+		return Money{Amount: amount * pow10(exp), Currency: strings.ToUpper(currency)}, nil
+	}
+
+	if money.Currency == "" {
+		money.Currency = currency
+	}
+	money.Currency = strings.ToUpper(money.Currency)
+
+	if money.Amount <= 0 {
+		return Money{}, &ValidationError{Fields: []FieldError{{Field: "Money.Amount", Tag: "gt", Message: "must be greater than 0"}}}
+	}
+
+	if _, ok := CurrencyExponent(money.Currency); !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrUnsupportedCurrency, money.Currency)
+	}
+
+	return money, nil
+}
+
+// checkExactAmount makes sure a vpc_Amount has no decimals currency
+// cannot hold, e.g. 12345 is 123.45 VND.
+func checkExactAmount(key, value, currency string) error {
+	exp, ok := CurrencyExponent(currency)
+	if !ok || exp >= gatewayExponent {
+		return nil
+	}
+
+	amount, _ := strconv.ParseInt(value, 10, 64)
+	if amount%pow10(gatewayExponent-exp) != 0 {
+		return &AmountError{Field: key, Value: value, Err: fmt.Errorf("%s has %d decimals", currency, exp)}
+	}
+
+	return nil
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,114 @@
+package payment
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMoney(t *testing.T) {
+	Convey("Money", t, func() {
+		Convey("parses decimal amounts exactly", func() {
+			m, err := ParseMoney("10.5", "usd")
+			So(err, ShouldBeNil)
+			So(m, ShouldResemble, Money{Amount: 1050, Currency: "USD"})
+			So(m.String(), ShouldEqual, "10.50 USD")
+
+			m, err = ParseMoney("100000", "VND")
+			So(err, ShouldBeNil)
+			So(m.Amount, ShouldEqual, 100000)
+			So(m.String(), ShouldEqual, "100000 VND")
+
+			_, err = ParseMoney("10.005", "USD")
+			So(errors.Is(err, ErrMalformedAmount), ShouldBeTrue)
+
+			_, err = ParseMoney("1.5", "VND")
+			So(errors.Is(err, ErrMalformedAmount), ShouldBeTrue)
+
+			_, err = ParseMoney("-10.50", "USD")
+			So(errors.Is(err, ErrMalformedAmount), ShouldBeTrue)
+			_, err = ParseMoney("0", "VND")
+			So(errors.Is(err, ErrMalformedAmount), ShouldBeTrue)
+
+			_, err = ParseMoney("1", "XYZ")
+			So(errors.Is(err, ErrUnsupportedCurrency), ShouldBeTrue)
+		})
+
+		Convey("converts to and from vpc_Amount", func() {
+			amount, err := Money{Amount: 1050, Currency: "USD"}.gatewayAmount()
+			So(err, ShouldBeNil)
+			So(amount, ShouldEqual, 1050)
+
+			amount, err = Money{Amount: 100000, Currency: "VND"}.gatewayAmount()
+			So(err, ShouldBeNil)
+			So(amount, ShouldEqual, 10000000)
+
+			_, err = Money{Amount: 1 << 62, Currency: "VND"}.gatewayAmount()
+			So(errors.Is(err, ErrValidation), ShouldBeTrue)
+			_, err = Money{Amount: 9999999999 + 1, Currency: "VND"}.gatewayAmount()
+			So(errors.Is(err, ErrValidation), ShouldBeTrue)
+			_, err = Money{Amount: -100, Currency: "USD"}.gatewayAmount()
+			So(errors.Is(err, ErrValidation), ShouldBeTrue)
+
+			So(moneyFromGateway(1050, "USD"), ShouldResemble, Money{Amount: 1050, Currency: "USD"})
+			So(moneyFromGateway(10000000, ""), ShouldResemble, Money{Amount: 100000, Currency: "VND"})
+		})
+
+		Convey("keeps the deprecated Amount working", func() {
+			m, err := resolveMoney(100000, Money{}, "VND")
+			So(err, ShouldBeNil)
+			So(m, ShouldResemble, Money{Amount: 100000, Currency: "VND"})
+
+			m, err = resolveMoney(10, Money{}, "USD")
+			So(err, ShouldBeNil)
+			So(m.Amount, ShouldEqual, 1000)
+
+			_, err = resolveMoney(0, Money{}, "VND")
+			So(errors.Is(err, ErrValidation), ShouldBeTrue)
+		})
+
+		Convey("refuses to sign an amount out of range", func() {
+			op := NewSandboxInternational("https://example.com/callback")
+			_, err := op.BuildCheckoutURL(&CheckoutParams{
+				Money:       Money{Amount: 1 << 62, Currency: "VND"},
+				OrderInfo:   "order",
+				MerchTxnRef: "ref-1",
+				TicketNo:    "127.0.0.1",
+				Title:       "Checkout",
+				AgainLink:   "https://example.com/cart",
+			})
+			So(errors.Is(err, ErrValidation), ShouldBeTrue)
+		})
+
+		Convey("domestic only charges VND", func() {
+			op := NewSandboxDomestic("https://example.com/callback")
+			_, err := op.BuildCheckoutURL(&CheckoutParams{
+				Money:       Money{Amount: 1050, Currency: "USD"},
+				OrderInfo:   "order",
+				MerchTxnRef: "ref-1",
+				TicketNo:    "127.0.0.1",
+				Title:       "Checkout",
+				AgainLink:   "https://example.com/cart",
+			})
+			So(errors.Is(err, ErrUnsupportedCurrency), ShouldBeTrue)
+		})
+
+		Convey("rejects a VND callback amount with decimals", func() {
+			op := NewSandboxDomestic("https://example.com/callback")
+
+			v := url.Values{}
+			v.Set("vpc_MerchTxnRef", "ref-1")
+			v.Set("vpc_TxnResponseCode", "0")
+			v.Set("vpc_CurrencyCode", "VND")
+			v.Set("vpc_Amount", "10000050")
+			addSecureHash(&v, op.Cfg.SecureSecret)
+
+			_, err := op.HandleCallback(v)
+			var aerr *AmountError
+			So(errors.As(err, &aerr), ShouldBeTrue)
+			So(aerr.Field, ShouldEqual, "vpc_Amount")
+		})
+	})
+}
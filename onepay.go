@@ -1,47 +1,179 @@
 package payment
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/schema"
-	"github.com/parnurzeal/gorequest"
-	"gopkg.in/go-playground/validator.v9"
 )
 
 // Defines ...
 const (
 	VPCSecureHashKey = "vpc_SecureHash"
 	VPCPrefix        = "vpc_"
+
+	CommandPay       = "pay"
+	CommandAuthorize = "authorize"
+
+	// DefaultHTTPTimeout bounds a gateway call when Config.HTTPClient is nil
+	DefaultHTTPTimeout = 30 * time.Second
 )
 
+var defaultHTTPClient = &http.Client{Timeout: DefaultHTTPTimeout}
+
 // Config ...
 type Config struct {
-	PaymentGatewayHost string `validate:"required" yaml:"payment_gateway_host" json:"payment_gateway_host"`
-	PaymentGatewayPath string `validate:"required" yaml:"payment_gateway_path" json:"payment_gateway_path"`
-	Merchant           string `validate:"required" yaml:"merchant" json:"merchant"`
-	AccessCode         string `validate:"required" yaml:"access_code" json:"access_code"`
-	ReturnURL          string `validate:"required,max=128" yaml:"return_url" json:"return_url"`
-	SecureSecret       string `validate:"required" yaml:"secure_secret" json:"secure_secret"`
-	QueryDRPath        string `validate:"required" yaml:"query_dr_path" json:"query_dr_path"`
-	User               string `validate:"required" yaml:"user" json:"user"`
-	Password           string `validate:"required" yaml:"password" json:"password"`
+	// PaymentGatewayScheme defaults to https, onepaytest serves plain http
+	PaymentGatewayScheme string `yaml:"payment_gateway_scheme" json:"payment_gateway_scheme"`
+	PaymentGatewayHost   string `validate:"required" yaml:"payment_gateway_host" json:"payment_gateway_host"`
+	PaymentGatewayPath   string `validate:"required" yaml:"payment_gateway_path" json:"payment_gateway_path"`
+	Merchant             string `validate:"required" yaml:"merchant" json:"merchant"`
+	AccessCode           string `validate:"required" yaml:"access_code" json:"access_code"`
+	ReturnURL            string `validate:"required,max=128" yaml:"return_url" json:"return_url"`
+	SecureSecret         string `validate:"required" yaml:"secure_secret" json:"secure_secret"`
+	QueryDRPath          string `validate:"required" yaml:"query_dr_path" json:"query_dr_path"`
+	User                 string `validate:"required" yaml:"user" json:"user"`
+	Password             string `validate:"required" yaml:"password" json:"password"`
+
+	// VerificationSecrets are also accepted on callbacks while OnePay rotates
+	// the secret, requests are always signed with SecureSecret.
+	VerificationSecrets []string `validate:"dive,required" yaml:"verification_secrets" json:"verification_secrets"`
+
+	// HTTPClient is used for outbound calls (QueryDR, Refund, ...), nil means
+	// a client with DefaultHTTPTimeout. Set its Transport to stub the gateway.
+	HTTPClient *http.Client `validate:"-" yaml:"-" json:"-"`
 }
 
 // CheckoutParams ...
 type CheckoutParams struct {
-	Amount      int64  `validate:"required,lte=9999999999"`
+	// Money is the amount to charge, its Currency defaults to the Currency
+	// of the client.
+	Money Money `validate:"-"`
+	// Amount is in whole units of the Currency of the client, ignored
+	// when Money is set.
+	//
+	// Deprecated: use Money, Amount cannot hold cents.
+	Amount      int64  `validate:"omitempty,gt=0,lte=9999999999"`
 	OrderInfo   string `validate:"required,max=34"`
 	MerchTxnRef string `validate:"required,max=40"`
-	TicketNo    string `validate:"required,max=15"`
+	TicketNo    string `validate:"required,max=45"`
 	Title       string `validate:"required,max=64"`
 	AgainLink   string `validate:"required,max=64"`
+
+	// Authorize only holds the funds, use OnePayInternational.Capture to
+	// collect them later. Not supported by OnePayDomestic.
+	Authorize bool
+
+	// Optional, sent as vpc_Customer_*, vpc_AVS_* and vpc_SHIP_*
+	Customer        *Customer
+	BillingAddress  *BillingAddress
+	ShippingAddress *ShippingAddress
+}
+
+// Customer ...
+type Customer struct {
+	ID    string `validate:"omitempty,max=64"`
+	Email string `validate:"omitempty,max=24,email"`
+	Phone string `validate:"omitempty,max=16"`
+}
+
+// BillingAddress is checked by the card issuer (AVS), OnePay International
+// uses it for fraud screening.
+type BillingAddress struct {
+	Street01  string `validate:"omitempty,max=64"`
+	City      string `validate:"omitempty,max=64"`
+	StateProv string `validate:"omitempty,max=64"`
+	PostCode  string `validate:"omitempty,max=10"`
+	Country   string `validate:"omitempty,max=3"`
+}
+
+// ShippingAddress ...
+type ShippingAddress struct {
+	Street01 string `validate:"omitempty,max=500"`
+	Province string `validate:"omitempty,max=50"`
+	City     string `validate:"omitempty,max=50"`
+	Country  string `validate:"omitempty,max=50"`
+}
+
+func (params *CheckoutParams) addOptionalParams(v *url.Values) {
+	addIfNotEmpty := func(key, value string) {
+		if value != "" {
+			v.Add(key, value)
+		}
+	}
+
+	if c := params.Customer; c != nil {
+		addIfNotEmpty("vpc_Customer_Id", c.ID)
+		addIfNotEmpty("vpc_Customer_Email", c.Email)
+		addIfNotEmpty("vpc_Customer_Phone", c.Phone)
+	}
+
+	if a := params.BillingAddress; a != nil {
+		addIfNotEmpty("vpc_AVS_Street01", a.Street01)
+		addIfNotEmpty("vpc_AVS_City", a.City)
+		addIfNotEmpty("vpc_AVS_StateProv", a.StateProv)
+		addIfNotEmpty("vpc_AVS_PostCode", a.PostCode)
+		addIfNotEmpty("vpc_AVS_Country", a.Country)
+	}
+
+	// OnePay spells it vpc_SHIP_Provice
+	if a := params.ShippingAddress; a != nil {
+		addIfNotEmpty("vpc_SHIP_Street01", a.Street01)
+		addIfNotEmpty("vpc_SHIP_Provice", a.Province)
+		addIfNotEmpty("vpc_SHIP_City", a.City)
+		addIfNotEmpty("vpc_SHIP_Country", a.Country)
+	}
+}
+
+// acceptedSecrets returns SecureSecret followed by VerificationSecrets.
+func (cfg *Config) acceptedSecrets() []string {
+	secrets := []string{cfg.SecureSecret}
+	for _, secret := range cfg.VerificationSecrets {
+		if secret != cfg.SecureSecret {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+func (cfg *Config) httpClient() *http.Client {
+	if cfg.HTTPClient != nil {
+		return cfg.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+func (cfg *Config) gatewayURL(path string, v url.Values) *url.URL {
+	scheme := cfg.PaymentGatewayScheme
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	return &url.URL{
+		Scheme:   scheme,
+		Host:     cfg.PaymentGatewayHost,
+		Path:     path,
+		RawQuery: v.Encode(),
+	}
+}
+
+// SecureHash returns the vpc_SecureHash of v, as computed by addSecureHash.
+func SecureHash(v url.Values, secureSecret string) (string, error) {
+	data, err := genStringForHash(&v)
+	if err != nil {
+		return "", err
+	}
+
+	return genHash(data, secureSecret)
 }
 
 // How to gen secure hash
@@ -69,14 +201,44 @@ func validateSecureHash(v *url.Values, secureSecret string) (bool, error) {
 		return false, err
 	}
 
-	receivedSecureHash := v.Get(VPCSecureHashKey)
-
 	secureHash, err := genHash(data, secureSecret)
 	if err != nil {
 		return false, err
 	}
 
-	return receivedSecureHash == secureHash, nil
+	received, err := hex.DecodeString(v.Get(VPCSecureHashKey))
+	if err != nil {
+		return false, nil
+	}
+
+	expected, _ := hex.DecodeString(secureHash)
+
+	// constant time, the comparison must not leak how much of it matched
+	return hmac.Equal(received, expected), nil
+}
+
+// matchSecureHash returns the first secret whose hash matches
+// vpc_SecureHash, or an empty string when none does.
+func matchSecureHash(v *url.Values, secrets []string) (string, error) {
+	for _, secret := range secrets {
+		ok, err := validateSecureHash(v, secret)
+		if err != nil {
+			return "", err
+		}
+
+		if ok {
+			return secret, nil
+		}
+	}
+
+	return "", nil
+}
+
+// SecretFingerprint identifies a secret without revealing it, it is the
+// first 8 hex characters of its SHA-256.
+func SecretFingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(secret)))
+	return strings.ToUpper(hex.EncodeToString(sum[:4]))
 }
 
 func genStringForHash(v *url.Values) (string, error) {
@@ -93,45 +255,51 @@ func genStringForHash(v *url.Values) (string, error) {
 	return url.QueryUnescape(vpcParams.Encode())
 }
 
-func genHash(urlQuery, secret string) (string, error) {
-	unescapedQuery, err := url.QueryUnescape(urlQuery)
-	if err != nil {
-		return "", err
-	}
-
+// genHash expects data already unescaped by genStringForHash,
+// unescaping it again would turn a '+' inside a value into a space.
+func genHash(data, secret string) (string, error) {
 	hexByteSecret, err := hex.DecodeString(secret)
 	if err != nil {
-		return "", err
+		return "", &ConfigError{Fields: []FieldError{{Field: "secure_secret", Tag: "hex", Message: "must be hex encoded"}}}
 	}
 
 	h := hmac.New(sha256.New, hexByteSecret)
-	h.Write([]byte(unescapedQuery))
+	h.Write([]byte(data))
 	sha := hex.EncodeToString(h.Sum(nil))
 
 	return strings.ToUpper(sha), nil
 }
 
-func handleCallback(v url.Values, secureSecret string, resp interface{}) error {
+// handleCallback returns the fingerprint of the secret that signed v.
+func handleCallback(v url.Values, cfg *Config, resp interface{}) (string, error) {
+	if cfg == nil {
+		return "", ErrNilConfig
+	}
 
-	ok, err := validateSecureHash(&v, secureSecret)
+	secret, err := matchSecureHash(&v, cfg.acceptedSecrets())
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	if !ok {
-		return errors.New("Invalid secure_hash")
+	if secret == "" {
+		return "", ErrInvalidSignature
+	}
+
+	err = checkAmounts(v)
+	if err != nil {
+		return "", err
 	}
 
 	var decoder = schema.NewDecoder()
 
 	decoder.IgnoreUnknownKeys(true)
 
-	err = decoder.Decode(resp, map[string][]string(v))
+	err = decoder.Decode(resp, normalizeThreeDSKeys(v))
 	if err != nil {
-		return err
+		return "", decodeError(err)
 	}
 
-	return nil
+	return SecretFingerprint(secret), nil
 }
 
 // DomesticResponse ...
@@ -164,6 +332,19 @@ type DomesticResponse struct {
 	Title     string `json:"Title" query:"Title" schema:"Title"`
 
 	TxnResponseMessage ErrorMessageLocale `json:"txnResponseCode" query:"txnResponseCode" schema:"txnResponseCode"`
+
+	// Money is the exact VPCAmount, VPCAmount is truncated to whole units
+	Money Money `json:"money" query:"-" schema:"-"`
+
+	// ThreeDS interprets the 3-D Secure fields
+	ThreeDS ThreeDSResult `json:"three_ds" query:"-" schema:"-"`
+
+	// SecretFingerprint identifies which accepted secret signed the callback
+	SecretFingerprint string `json:"secret_fingerprint" query:"-" schema:"-"`
+
+	// Settled is true for the one callback that moved the transaction out
+	// of pending, fulfil the order only then
+	Settled bool `json:"-" query:"-" schema:"-"`
 }
 
 // InternationalResponse ...
@@ -216,25 +397,67 @@ type InternationalResponse struct {
 	Title     string `json:"Title" query:"Title" schema:"Title"`
 
 	TxnResponseMessage ErrorMessageLocale `json:"txnResponseCode" query:"txnResponseCode" schema:"txnResponseCode"`
+
+	// Money is the exact VPCAmount, VPCAmount is truncated to whole units
+	Money Money `json:"money" query:"-" schema:"-"`
+
+	// ThreeDS interprets the 3-D Secure fields
+	ThreeDS ThreeDSResult `json:"three_ds" query:"-" schema:"-"`
+
+	// AVSResult and CSCResult decode VPCAVSResultCode and VPCCSCResultCode
+	AVSResult AVSResult `json:"avs_result" query:"-" schema:"-"`
+	CSCResult CSCResult `json:"csc_result" query:"-" schema:"-"`
+
+	// Fraud is set by HandleCallback when OnePayInternational.Fraud is,
+	// the payment is settled whatever the decision
+	Fraud *FraudAssessment `json:"fraud,omitempty" query:"-" schema:"-"`
+
+	// SecretFingerprint identifies which accepted secret signed the callback
+	SecretFingerprint string `json:"secret_fingerprint" query:"-" schema:"-"`
+
+	// Settled is true for the one callback that moved the transaction out
+	// of pending, fulfil the order only then
+	Settled bool `json:"-" query:"-" schema:"-"`
 }
 
 // PostProcess ...
 func (r *DomesticResponse) PostProcess() {
+	r.Money = moneyFromGateway(r.VPCAmount, r.VPCCurrencyCode)
 	r.VPCAmount = r.VPCAmount / 100
-	r.TxnResponseMessage = ErrorMap[r.VPCTxnResponseCode]
+	r.TxnResponseMessage = responseMessage(ChannelDomestic, r.VPCTxnResponseCode)
+	r.ThreeDS = DecodeThreeDS(r.VPCCard, r.VPC3DSECI, r.VPC3Dsenrolled, r.VPC3Dsstatus)
 }
 
 // PostProcess ...
 func (r *InternationalResponse) PostProcess() {
+	r.Money = moneyFromGateway(r.VPCAmount, r.VPCCurrencyCode)
 	r.VPCAmount = r.VPCAmount / 100
-	r.TxnResponseMessage = ErrorMap[r.VPCTxnResponseCode]
+	r.TxnResponseMessage = responseMessage(ChannelInternational, r.VPCTxnResponseCode)
+	r.AVSResult = DecodeAVSResult(r.VPCAVSResultCode)
+	r.CSCResult = DecodeCSCResult(r.VPCCSCResultCode)
+
+	if r.VPC3DSstatus == "" && r.VPCVerStatus != "" {
+		r.ThreeDS = DecodeThreeDSVerStatus(r.VPCCard, r.VPC3DSECI, r.VPC3DSenrolled, r.VPCVerStatus)
+	} else {
+		r.ThreeDS = DecodeThreeDS(r.VPCCard, r.VPC3DSECI, r.VPC3DSenrolled, r.VPC3DSstatus)
+	}
+}
+
+// Err returns a *DeclineError when the payment was not approved, nil otherwise.
+func (r *DomesticResponse) Err() error {
+	return declineError(ChannelDomestic, r.VPCTxnResponseCode)
+}
+
+// Err returns a *DeclineError when the payment was not approved, nil otherwise.
+func (r *InternationalResponse) Err() error {
+	return declineError(ChannelInternational, r.VPCTxnResponseCode)
 }
 
 // QueryDRAPIRequest ...
 type QueryDRAPIRequest struct {
 	VPCCommand     string `json:"vpc_Command" query:"vpc_Command" schema:"vpc_Command"`
 	VPCVersion     string `json:"vpc_Version" query:"vpc_Version" schema:"vpc_Version"`
-	VPCMerchTxnRef string `json:"vpc_MerchTxnRef" query:"vpc_MerchTxnRef" schema:"vpc_MerchTxnRef"`
+	VPCMerchTxnRef string `json:"vpc_MerchTxnRef" query:"vpc_MerchTxnRef" schema:"vpc_MerchTxnRef" validate:"required,max=40"`
 	VPCMerchant    string `json:"vpc_Merchant" query:"vpc_Merchant" schema:"vpc_Merchant"`
 	VPCAccessCode  string `json:"vpc_AccessCode" query:"vpc_AccessCode" schema:"vpc_AccessCode"`
 	VPCUser        string `json:"vpc_User" query:"vpc_User" schema:"vpc_User"`
@@ -245,15 +468,52 @@ type QueryDRAPIRequest struct {
 // QueryDRAPIResponse ...
 type QueryDRAPIResponse struct {
 	VPCDRExists        string `json:"vpc_DRExists" query:"vpc_DRExists" schema:"vpc_DRExists"`
-	VPCTxnResponseCode string `json:"vpc_TxnResponseCodes" query:"vpc_TxnResponseCodes" schema:"vpc_TxnResponseCodes"`
+	VPCCommand         string `json:"vpc_Command" query:"vpc_Command" schema:"vpc_Command"`
+	VPCLocale          string `json:"vpc_Locale" query:"vpc_Locale" schema:"vpc_Locale"`
+	VPCCurrencyCode    string `json:"vpc_CurrencyCode" query:"vpc_CurrencyCode" schema:"vpc_CurrencyCode"`
+	VPCMerchant        string `json:"vpc_Merchant" query:"vpc_Merchant" schema:"vpc_Merchant"`
+	VPCMerchTxnRef     string `json:"vpc_MerchTxnRef" query:"vpc_MerchTxnRef" schema:"vpc_MerchTxnRef"`
+	VPCOrderInfo       string `json:"vpc_OrderInfo" query:"vpc_OrderInfo" schema:"vpc_OrderInfo"`
+	VPCAmount          int64  `json:"vpc_Amount" query:"vpc_Amount" schema:"vpc_Amount"`
+	VPCTransactionNo   string `json:"vpc_TransactionNo" query:"vpc_TransactionNo" schema:"vpc_TransactionNo"`
+	VPCCard            string `json:"vpc_Card" query:"vpc_Card" schema:"vpc_Card"`
+	VPCMessage         string `json:"vpc_Message" query:"vpc_Message" schema:"vpc_Message"`
+	VPCTxnResponseCode string `json:"vpc_TxnResponseCode" query:"vpc_TxnResponseCode" schema:"vpc_TxnResponseCode"`
+	VPCSecureHash      string `json:"vpc_SecureHash" query:"vpc_SecureHash" schema:"vpc_SecureHash"`
+
+	TxnResponseMessage ErrorMessageLocale `json:"txnResponseCode" query:"txnResponseCode" schema:"txnResponseCode"`
+
+	// Money is the exact VPCAmount, VPCAmount is truncated to whole units
+	Money Money `json:"money" query:"-" schema:"-"`
+
+	// SecretFingerprint identifies which accepted secret signed the callback
+	SecretFingerprint string `json:"secret_fingerprint" query:"-" schema:"-"`
+
+	// channel picks the response code table, set by the client
+	channel Channel
+	// settled is set by the client QueryDR when it moved the transaction
+	// out of StatePending in its Store
+	settled bool
 }
 
-func queryDR(cfg *Config, request *QueryDRAPIRequest) (res *QueryDRAPIResponse, err error) {
+// PostProcess ...
+func (r *QueryDRAPIResponse) PostProcess() {
+	r.Money = moneyFromGateway(r.VPCAmount, r.VPCCurrencyCode)
+	r.VPCAmount = r.VPCAmount / 100
+	r.TxnResponseMessage = responseMessage(r.channel, r.VPCTxnResponseCode)
+}
+
+// Exists reports whether OnePay knows the MerchTxnRef (vpc_DRExists=Y).
+func (r *QueryDRAPIResponse) Exists() bool {
+	return r.VPCDRExists == "Y"
+}
+
+func queryDR(ctx context.Context, cfg *Config, channel Channel, request *QueryDRAPIRequest) (res *QueryDRAPIResponse, err error) {
 	if cfg == nil {
-		return nil, fmt.Errorf("Config is nil")
+		return nil, ErrNilConfig
 	}
 
-	err = validator.New().Struct(request)
+	err = validateStruct(request)
 	if err != nil {
 		return nil, err
 	}
@@ -268,6 +528,22 @@ func queryDR(cfg *Config, request *QueryDRAPIRequest) (res *QueryDRAPIResponse,
 		request.VPCVersion = "1"
 	}
 
+	if request.VPCMerchant == "" {
+		request.VPCMerchant = cfg.Merchant
+	}
+
+	if request.VPCAccessCode == "" {
+		request.VPCAccessCode = cfg.AccessCode
+	}
+
+	if request.VPCUser == "" {
+		request.VPCUser = cfg.User
+	}
+
+	if request.VPCPassword == "" {
+		request.VPCPassword = cfg.Password
+	}
+
 	v.Add("vpc_Command", request.VPCCommand)
 	v.Add("vpc_Version", request.VPCVersion)
 	v.Add("vpc_MerchTxnRef", request.VPCMerchTxnRef)
@@ -276,24 +552,139 @@ func queryDR(cfg *Config, request *QueryDRAPIRequest) (res *QueryDRAPIResponse,
 	v.Add("vpc_User", request.VPCUser)
 	v.Add("vpc_Password", request.VPCPassword)
 
-	addSecureHash(&v, cfg.SecureSecret)
+	body, err := requestDPS(ctx, cfg, http.MethodGet, v)
+	if err != nil {
+		return nil, err
+	}
 
-	u := &url.URL{
-		Scheme:   "https",
-		Host:     cfg.PaymentGatewayHost,
-		Path:     cfg.QueryDRPath,
-		RawQuery: v.Encode(),
+	res = &QueryDRAPIResponse{channel: channel}
+	err = decodeDPSResponse(body, cfg, res)
+	if err != nil {
+		return nil, err
 	}
 
-	_, body, errs := gorequest.New().Get(u.String()).End()
-	if len(errs) > 0 {
-		return nil, fmt.Errorf("%v", errs)
+	res.PostProcess()
+
+	return res, nil
+}
+
+// requestDPS sends a signed admin request (queryDR, refund, ...) to the
+// Vpcdps.op endpoint, the gateway answers with an url encoded body.
+// Failures are wrapped in a *TransportError.
+func requestDPS(ctx context.Context, cfg *Config, method string, v url.Values) (url.Values, error) {
+	err := addSecureHash(&v, cfg.SecureSecret)
+	if err != nil {
+		return nil, err
 	}
 
-	err = json.Unmarshal([]byte(body), &res)
+	command := v.Get("vpc_Command")
+
+	var req *http.Request
+	if method == http.MethodGet {
+		req, err = http.NewRequestWithContext(ctx, method, cfg.gatewayURL(cfg.QueryDRPath, v).String(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, cfg.gatewayURL(cfg.QueryDRPath, nil).String(), strings.NewReader(v.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return res, err
+	res, err := cfg.httpClient().Do(req)
+	if err != nil {
+		return nil, &TransportError{Command: command, Err: err}
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, &TransportError{Command: command, StatusCode: res.StatusCode, Err: err}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &TransportError{
+			Command:    command,
+			StatusCode: res.StatusCode,
+			Err:        fmt.Errorf("Unexpected status from gateway: %s", body),
+		}
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, &TransportError{Command: command, StatusCode: res.StatusCode, Err: err}
+	}
+
+	return values, nil
+}
+
+// decodeDPSResponse checks vpc_SecureHash, then decodes the values into
+// resp. Only the answers of unsignedDPSResponse may come without one.
+func decodeDPSResponse(v url.Values, cfg *Config, resp interface{}) error {
+	if v.Get(VPCSecureHashKey) == "" {
+		if !unsignedDPSResponse(v) {
+			return ErrMissingSecureHash
+		}
+	} else {
+		secret, err := matchSecureHash(&v, cfg.acceptedSecrets())
+		if err != nil {
+			return err
+		}
+
+		if secret == "" {
+			return ErrInvalidSignature
+		}
+	}
+
+	err := checkAmounts(v)
+	if err != nil {
+		return err
+	}
+
+	var decoder = schema.NewDecoder()
+
+	decoder.IgnoreUnknownKeys(true)
+
+	return decodeError(decoder.Decode(resp, map[string][]string(v)))
+}
+
+// unsignedDPSResponse reports whether OnePay documents v as unsigned,
+// only the queryDR answer for an unknown MerchTxnRef (vpc_DRExists=N).
+func unsignedDPSResponse(v url.Values) bool {
+	return v.Get("vpc_DRExists") == "N"
+}
+
+// checkAmounts makes sure every vpc_*Amount value is an integer before
+// decoding, the schema decoder would report a less useful error. When
+// the currency is known the amounts must also be exact in it.
+func checkAmounts(v url.Values) error {
+	currency := v.Get("vpc_CurrencyCode")
+	if currency == "" {
+		currency = v.Get("vpc_Currency")
+	}
+
+	for key, values := range v {
+		if !strings.HasPrefix(key, VPCPrefix) || !strings.HasSuffix(key, "Amount") {
+			continue
+		}
+
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+
+			_, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return &AmountError{Field: key, Value: value, Err: err}
+			}
+
+			err = checkExactAmount(key, value, currency)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
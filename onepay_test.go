@@ -1,7 +1,15 @@
 package payment
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/k0kubun/pp"
@@ -21,6 +29,297 @@ func TestOnePay(t *testing.T) {
 			ok, err := validateSecureHash(&v, "6D0870CDE5F24F34F3915FB0045120DB")
 			So(err, ShouldBeNil)
 			So(ok, ShouldBeTrue)
+
+			v.Set(VPCSecureHashKey, "B233867E915FFC67A2EA71E79E4C7FED44B589FD7AD71DD57ADA5642247EBA51")
+			ok, err = validateSecureHash(&v, "6D0870CDE5F24F34F3915FB0045120DB")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+
+			v.Set(VPCSecureHashKey, "not hex")
+			ok, err = validateSecureHash(&v, "6D0870CDE5F24F34F3915FB0045120DB")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("hashes '+' and '%' in values as sent", func() {
+			secret := "6D0870CDE5F24F34F3915FB0045120DB"
+
+			v := url.Values{}
+			v.Set("vpc_VerToken", "jHyn+7YFi1EUAREAAAAvNUe6Hv8=")
+			v.Set("vpc_OrderInfo", "50%41 off")
+
+			key, err := hex.DecodeString(secret)
+			So(err, ShouldBeNil)
+			h := hmac.New(sha256.New, key)
+			h.Write([]byte("vpc_OrderInfo=50%41 off&vpc_VerToken=jHyn+7YFi1EUAREAAAAvNUe6Hv8="))
+			want := strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+
+			hash, err := SecureHash(v, secret)
+			So(err, ShouldBeNil)
+			So(hash, ShouldEqual, want)
+
+			v.Set("vpc_OrderInfo", "100%")
+			_, err = SecureHash(v, secret)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Gateway", func() {
+			gateways := map[Channel]Gateway{}
+			for _, gw := range []Gateway{
+				NewSandboxDomestic("https://example.com/callback"),
+				NewSandboxInternational("https://example.com/callback"),
+			} {
+				gateways[gw.Channel()] = gw
+			}
+			So(gateways, ShouldContainKey, ChannelDomestic)
+			So(gateways, ShouldContainKey, ChannelInternational)
+
+			resp := &InternationalResponse{
+				VPCMerchTxnRef:     "1569179952150041000",
+				VPCTxnResponseCode: "0",
+				VPCReceiptNo:       "926519189281",
+			}
+			resp.PostProcess()
+
+			result := resp.Result()
+			So(result.Channel, ShouldEqual, ChannelInternational)
+			So(result.MerchTxnRef, ShouldEqual, "1569179952150041000")
+			So(result.Approved(), ShouldBeTrue)
+			So(result.Domestic, ShouldBeNil)
+			So(result.International.VPCReceiptNo, ShouldEqual, "926519189281")
+		})
+
+		Convey("QueryDR", func() {
+			op := NewSandboxDomestic("https://example.com/callback")
+
+			var got *http.Request
+			op.Cfg.HTTPClient = &http.Client{
+				Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					got = req
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(strings.NewReader("vpc_DRExists=N")),
+					}, nil
+				}),
+			}
+
+			Convey("uses Config.HTTPClient", func() {
+				res, err := op.QueryDR(context.Background(), &QueryDRAPIRequest{VPCMerchTxnRef: "ref-1"})
+				So(err, ShouldBeNil)
+				So(res.Exists(), ShouldBeFalse)
+				So(got.URL.Host, ShouldEqual, "mtf.onepay.vn")
+				So(got.URL.Query().Get("vpc_MerchTxnRef"), ShouldEqual, "ref-1")
+			})
+
+			Convey("stops on a cancelled context", func() {
+				op.Cfg.HTTPClient = nil
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				_, err := op.QueryDR(ctx, &QueryDRAPIRequest{VPCMerchTxnRef: "ref-1"})
+				So(errors.Is(err, ErrGatewayTransport), ShouldBeTrue)
+				So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			})
+
+			Convey("reports a non 200 status", func() {
+				op.Cfg.HTTPClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusBadGateway,
+						Body:       io.NopCloser(strings.NewReader("down")),
+					}, nil
+				})
+
+				_, err := op.QueryDR(context.Background(), &QueryDRAPIRequest{VPCMerchTxnRef: "ref-1"})
+				var terr *TransportError
+				So(errors.As(err, &terr), ShouldBeTrue)
+				So(terr.Command, ShouldEqual, "queryDR")
+				So(terr.StatusCode, ShouldEqual, http.StatusBadGateway)
+			})
+
+			Convey("requires vpc_SecureHash once the transaction exists", func() {
+				op.Cfg.HTTPClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(strings.NewReader("vpc_DRExists=Y&vpc_TxnResponseCode=0&vpc_Amount=10000000")),
+					}, nil
+				})
+
+				_, err := op.QueryDR(context.Background(), &QueryDRAPIRequest{VPCMerchTxnRef: "ref-1"})
+				So(errors.Is(err, ErrMissingSecureHash), ShouldBeTrue)
+
+				op.Cfg.User = "op01"
+				op.Cfg.Password = "op123456"
+				_, err = op.Refund(context.Background(), &RefundParams{MerchTxnRef: "refund-1", TransactionNo: "1", Amount: 100000})
+				So(errors.Is(err, ErrMissingSecureHash), ShouldBeTrue)
+			})
+
+			Convey("is not sent when it cannot be signed", func() {
+				op.Cfg.SecureSecret = "not hex"
+
+				_, err := op.QueryDR(context.Background(), &QueryDRAPIRequest{VPCMerchTxnRef: "ref-1"})
+				var cerr *ConfigError
+				So(errors.As(err, &cerr), ShouldBeTrue)
+				So(cerr.Fields[0].Field, ShouldEqual, "secure_secret")
+				So(got, ShouldBeNil)
+			})
+
+			Convey("validates the request", func() {
+				_, err := op.QueryDR(context.Background(), &QueryDRAPIRequest{})
+				var verr *ValidationError
+				So(errors.As(err, &verr), ShouldBeTrue)
+				So(errors.Is(err, ErrValidation), ShouldBeTrue)
+				So(verr.Fields[0].Field, ShouldEqual, "VPCMerchTxnRef")
+				So(verr.Fields[0].Tag, ShouldEqual, "required")
+			})
+		})
+
+		Convey("BuildCheckoutURL", func() {
+			// same request as example/hash, signed by OnePay's own sample code
+			op := NewSandboxDomestic("http://localhost:8080/payment/onepaydom/callback")
+			params := &CheckoutParams{
+				Amount:      900000,
+				OrderInfo:   "node-2019-09-21T02:28:15.302Z",
+				MerchTxnRef: "node-2019-09-21T02:28:15.302Z",
+				TicketNo:    "::1",
+				Title:       "Checkout",
+				AgainLink:   "https://example.com/cart",
+				Customer: &Customer{
+					ID:    "dev@naustud.io",
+					Email: "dev@naustud.io",
+					Phone: "0123456789",
+				},
+				ShippingAddress: &ShippingAddress{
+					Street01: "187 Dien Bien Phu, Da Kao Ward",
+					Province: "Hồ Chí Minh",
+					City:     "01",
+					Country:  "VN",
+				},
+			}
+
+			checkoutURL, err := op.BuildCheckoutURL(params)
+			So(err, ShouldBeNil)
+
+			u, err := url.Parse(checkoutURL)
+			So(err, ShouldBeNil)
+
+			v := u.Query()
+			So(v.Get("vpc_Customer_Email"), ShouldEqual, "dev@naustud.io")
+			So(v.Get("vpc_SHIP_Provice"), ShouldEqual, "Hồ Chí Minh")
+			So(v.Get(VPCSecureHashKey), ShouldEqual, "CE24B16DDB3D1CA28B970370F7A8EDC82EAEC1E1801BFA710F00F41BE3705F3F")
+
+			Convey("validates OnePay length limits", func() {
+				params.Customer.Email = "a.very.long.address@naustud.io"
+				_, err := op.BuildCheckoutURL(params)
+				var verr *ValidationError
+				So(errors.As(err, &verr), ShouldBeTrue)
+				So(verr.Fields, ShouldHaveLength, 1)
+				So(verr.Fields[0].Field, ShouldEqual, "Customer.Email")
+				So(verr.Fields[0].Tag, ShouldEqual, "max")
+			})
+
+			Convey("reports a secret it cannot sign with", func() {
+				op.Cfg.SecureSecret = "not hex"
+				_, err := op.BuildCheckoutURL(params)
+				var cerr *ConfigError
+				So(errors.As(err, &cerr), ShouldBeTrue)
+				So(cerr.Fields[0].Field, ShouldEqual, "secure_secret")
+
+				intl := NewSandboxInternational("https://example.com/callback")
+				intl.Cfg.SecureSecret = "not hex"
+				_, err = intl.BuildCheckoutURL(&CheckoutParams{
+					Money:       Money{Amount: 1050, Currency: "USD"},
+					OrderInfo:   "order 1",
+					MerchTxnRef: "ref-1",
+					TicketNo:    "127.0.0.1",
+					Title:       "Checkout",
+					AgainLink:   "https://example.com/cart",
+				})
+				So(errors.As(err, &cerr), ShouldBeTrue)
+			})
+		})
+
+		Convey("secret rotation", func() {
+			oldSecret := "6D0870CDE5F24F34F3915FB0045120DB"
+
+			op := NewSandboxInternational("https://example.com/callback")
+			op.Cfg.SecureSecret = "00112233445566778899AABBCCDDEEFF"
+			op.Cfg.VerificationSecrets = []string{oldSecret}
+
+			sign := func(secret string) url.Values {
+				v := url.Values{}
+				v.Set("vpc_MerchTxnRef", "ref-1")
+				v.Set("vpc_TxnResponseCode", "0")
+				addSecureHash(&v, secret)
+				return v
+			}
+
+			resp, err := op.HandleCallback(sign(oldSecret))
+			So(err, ShouldBeNil)
+			So(resp.SecretFingerprint, ShouldEqual, SecretFingerprint(oldSecret))
+
+			resp, err = op.HandleCallback(sign(op.Cfg.SecureSecret))
+			So(err, ShouldBeNil)
+			So(resp.SecretFingerprint, ShouldEqual, SecretFingerprint(op.Cfg.SecureSecret))
+			So(resp.Result().SecretFingerprint, ShouldEqual, resp.SecretFingerprint)
+
+			_, err = op.HandleCallback(sign("A3EFDFABA8653DF2342E8DAC29B51AF0"))
+			So(errors.Is(err, ErrInvalidSignature), ShouldBeTrue)
+		})
+
+		Convey("callback errors", func() {
+			op := NewSandboxDomestic("https://example.com/callback")
+
+			sign := func(code, amount string) url.Values {
+				v := url.Values{}
+				v.Set("vpc_MerchTxnRef", "ref-1")
+				v.Set("vpc_TxnResponseCode", code)
+				v.Set("vpc_Amount", amount)
+				addSecureHash(&v, op.Cfg.SecureSecret)
+				return v
+			}
+
+			Convey("a decline is not an error of HandleCallback", func() {
+				resp, err := op.HandleCallback(sign("1", "100000"))
+				So(err, ShouldBeNil)
+
+				var decline *DeclineError
+				So(errors.As(resp.Err(), &decline), ShouldBeTrue)
+				So(decline.Code, ShouldEqual, "1")
+				So(errors.Is(resp.Result().Err(), ErrGatewayDecline), ShouldBeTrue)
+
+				resp, err = op.HandleCallback(sign("0", "100000"))
+				So(err, ShouldBeNil)
+				So(resp.Err(), ShouldBeNil)
+			})
+
+			Convey("rejects a malformed amount", func() {
+				_, err := op.HandleCallback(sign("0", "1e5"))
+				var aerr *AmountError
+				So(errors.As(err, &aerr), ShouldBeTrue)
+				So(aerr.Field, ShouldEqual, "vpc_Amount")
+				So(errors.Is(err, ErrMalformedAmount), ShouldBeTrue)
+			})
+
+			Convey("matches a sentinel for a bad secret or undecodable values", func() {
+				v := sign("0", "100000")
+				op.Cfg.SecureSecret = "not hex"
+
+				_, err := op.HandleCallback(v)
+				var cerr *ConfigError
+				So(errors.As(err, &cerr), ShouldBeTrue)
+				So(cerr.Fields[0].Field, ShouldEqual, "secure_secret")
+				So(errors.Is(err, ErrValidation), ShouldBeTrue)
+
+				So(errors.Is(decodeError(errors.New("schema: invalid path")), ErrValidation), ShouldBeTrue)
+				So(decodeError(nil), ShouldBeNil)
+			})
 		})
 	})
 }
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
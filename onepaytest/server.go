@@ -0,0 +1,462 @@
+// Package onepaytest provides a fake OnePay gateway for offline integration
+// tests. It serves the checkout pages (vpc.op, vpcpay.op) and the admin
+// endpoint (Vpcdps.op), and signs everything with the merchant SecureSecret.
+package onepaytest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tranduythanh/payment"
+)
+
+// Outcome is the vpc_TxnResponseCode the fake gateway answers with.
+type Outcome string
+
+// Defines scripted outcomes
+const (
+	Approved       Outcome = "0"
+	Declined       Outcome = "1"
+	UserCancel     Outcome = "99"
+	Timeout        Outcome = "253"
+	ThreeDSFailure Outcome = "F"
+)
+
+// Transaction is what the fake gateway remembers about a checkout.
+type Transaction struct {
+	Channel       payment.Channel
+	Merchant      string
+	MerchTxnRef   string
+	OrderInfo     string
+	TransactionNo string
+	Currency      string
+	Locale        string
+	Outcome       Outcome
+	// Command is pay or authorize
+	Command string
+	Voided  bool
+	// Amounts are in gateway unit (vpc_Amount, x100)
+	Amount   int64
+	Captured int64
+	Refunded int64
+}
+
+// refundable is what can still be refunded, an authorization has to be
+// captured first.
+func (txn *Transaction) refundable() int64 {
+	if txn.Command == payment.CommandAuthorize {
+		return txn.Captured - txn.Refunded
+	}
+	return txn.Amount - txn.Refunded
+}
+
+type merchant struct {
+	accessCode   string
+	secureSecret string
+	user         string
+	password     string
+}
+
+// Server ...
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	seq       int
+	merchants map[string]*merchant
+	outcomes  map[string]Outcome
+	txns      map[string]*Transaction
+	txnNos    map[string]*Transaction
+}
+
+// NewServer starts a fake gateway, call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		merchants: map[string]*merchant{},
+		outcomes:  map[string]Outcome{},
+		txns:      map[string]*Transaction{},
+		txnNos:    map[string]*Transaction{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Configure registers the merchant of cfg and returns a copy of cfg
+// pointing at the fake gateway.
+func (s *Server) Configure(cfg *payment.Config) *payment.Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.merchants[cfg.Merchant] = &merchant{
+		accessCode:   cfg.AccessCode,
+		secureSecret: cfg.SecureSecret,
+		user:         cfg.User,
+		password:     cfg.Password,
+	}
+
+	u, _ := url.Parse(s.URL)
+
+	c := *cfg
+	c.PaymentGatewayScheme = u.Scheme
+	c.PaymentGatewayHost = u.Host
+	c.HTTPClient = s.Client()
+	return &c
+}
+
+// SetOutcome scripts the result of the checkout for merchTxnRef,
+// unscripted checkouts are approved.
+func (s *Server) SetOutcome(merchTxnRef string, outcome Outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outcomes[merchTxnRef] = outcome
+}
+
+// Transaction ...
+func (s *Server) Transaction(merchTxnRef string) (Transaction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	txn, ok := s.txns[merchTxnRef]
+	if !ok {
+		return Transaction{}, false
+	}
+	return *txn, true
+}
+
+// Pay plays the customer: it opens checkoutURL and returns the query the
+// gateway redirects to ReturnURL with.
+func (s *Server) Pay(checkoutURL string) (url.Values, error) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := client.Get(checkoutURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("onepaytest: checkout failed: %s", body)
+	}
+
+	u, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		return nil, err
+	}
+	return u.Query(), nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/vpc.op"):
+		s.checkout(w, r, payment.ChannelDomestic)
+	case strings.HasSuffix(r.URL.Path, "/vpcpay.op"):
+		s.checkout(w, r, payment.ChannelInternational)
+	case strings.HasSuffix(r.URL.Path, "/Vpcdps.op"):
+		s.dps(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) verify(v url.Values) (*merchant, error) {
+	m, ok := s.merchants[v.Get("vpc_Merchant")]
+	if !ok {
+		return nil, errors.New("merchant not exist")
+	}
+
+	if v.Get("vpc_AccessCode") != m.accessCode {
+		return nil, errors.New("invalid access code")
+	}
+
+	hash, err := payment.SecureHash(v, m.secureSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash != v.Get(payment.VPCSecureHashKey) {
+		return nil, errors.New("invalid secure hash")
+	}
+
+	return m, nil
+}
+
+func (s *Server) checkout(w http.ResponseWriter, r *http.Request, channel payment.Channel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := r.Form
+
+	m, err := s.verify(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	amount, err := strconv.ParseInt(v.Get("vpc_Amount"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	returnURL, err := url.Parse(v.Get("vpc_ReturnURL"))
+	if err != nil {
+		http.Error(w, "invalid return url", http.StatusBadRequest)
+		return
+	}
+
+	outcome, ok := s.outcomes[v.Get("vpc_MerchTxnRef")]
+	if !ok {
+		outcome = Approved
+	}
+
+	s.seq++
+	txn := &Transaction{
+		Channel:       channel,
+		Merchant:      v.Get("vpc_Merchant"),
+		MerchTxnRef:   v.Get("vpc_MerchTxnRef"),
+		OrderInfo:     v.Get("vpc_OrderInfo"),
+		TransactionNo: fmt.Sprintf("%06d", s.seq),
+		Currency:      v.Get("vpc_Currency"),
+		Locale:        v.Get("vpc_Locale"),
+		Outcome:       outcome,
+		Command:       v.Get("vpc_Command"),
+		Amount:        amount,
+	}
+	s.txns[txn.MerchTxnRef] = txn
+	s.txnNos[txn.TransactionNo] = txn
+
+	res := url.Values{}
+	res.Set("vpc_Command", v.Get("vpc_Command"))
+	res.Set("vpc_Version", v.Get("vpc_Version"))
+	res.Set("vpc_Locale", txn.Locale)
+	res.Set("vpc_CurrencyCode", txn.Currency)
+	res.Set("vpc_Merchant", txn.Merchant)
+	res.Set("vpc_MerchTxnRef", txn.MerchTxnRef)
+	res.Set("vpc_OrderInfo", txn.OrderInfo)
+	res.Set("vpc_Amount", v.Get("vpc_Amount"))
+	res.Set("vpc_TransactionNo", txn.TransactionNo)
+	res.Set("vpc_TxnResponseCode", string(outcome))
+	res.Set("vpc_Message", message(channel, outcome))
+
+	if channel == payment.ChannelInternational {
+		res.Set("vpc_Card", "VC")
+		res.Set("vpc_CardNum", "400555xxxxxx0001")
+		res.Set("vpc_3DSenrolled", "Y")
+		res.Set("vpc_3DSstatus", "Y")
+		res.Set("vpc_3DSECI", "05")
+		if outcome == ThreeDSFailure {
+			res.Set("vpc_3DSstatus", "N")
+			res.Set("vpc_3DSECI", "07")
+		}
+	}
+
+	err = addSecureHash(res, m.secureSecret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Set("AgainLink", v.Get("AgainLink"))
+	res.Set("Title", v.Get("Title"))
+
+	returnURL.RawQuery = res.Encode()
+	http.Redirect(w, r, returnURL.String(), http.StatusFound)
+}
+
+func (s *Server) dps(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := r.Form
+
+	m, err := s.verify(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if v.Get("vpc_User") != m.user || v.Get("vpc_Password") != m.password {
+		http.Error(w, "invalid user or password", http.StatusUnauthorized)
+		return
+	}
+
+	res := url.Values{}
+	res.Set("vpc_Command", v.Get("vpc_Command"))
+	res.Set("vpc_Merchant", v.Get("vpc_Merchant"))
+	res.Set("vpc_MerchTxnRef", v.Get("vpc_MerchTxnRef"))
+
+	switch v.Get("vpc_Command") {
+	case "queryDR":
+		s.queryDR(v, res)
+	case "refund":
+		s.refund(v, res)
+	case "capture":
+		s.capture(v, res)
+	case "voidAuthorisation":
+		s.void(v, res)
+	default:
+		res.Set("vpc_TxnResponseCode", "7")
+		res.Set("vpc_Message", "Unsupported command")
+	}
+
+	err = addSecureHash(res, m.secureSecret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, res.Encode())
+}
+
+func (s *Server) queryDR(v url.Values, res url.Values) {
+	txn, ok := s.txns[v.Get("vpc_MerchTxnRef")]
+	if !ok {
+		res.Set("vpc_DRExists", "N")
+		return
+	}
+
+	res.Set("vpc_DRExists", "Y")
+	res.Set("vpc_Amount", strconv.FormatInt(txn.Amount, 10))
+	res.Set("vpc_CurrencyCode", txn.Currency)
+	res.Set("vpc_Locale", txn.Locale)
+	res.Set("vpc_OrderInfo", txn.OrderInfo)
+	res.Set("vpc_TransactionNo", txn.TransactionNo)
+	res.Set("vpc_TxnResponseCode", string(txn.Outcome))
+	res.Set("vpc_Message", message(txn.Channel, txn.Outcome))
+	if txn.Channel == payment.ChannelInternational {
+		res.Set("vpc_Card", "VC")
+	}
+}
+
+func (s *Server) refund(v url.Values, res url.Values) {
+	amount, err := strconv.ParseInt(v.Get("vpc_Amount"), 10, 64)
+	if err != nil {
+		res.Set("vpc_TxnResponseCode", "5")
+		res.Set("vpc_Message", "Invalid amount")
+		return
+	}
+
+	txn, ok := s.txnNos[v.Get("vpc_TransNo")]
+	if !ok || txn.Outcome != Approved {
+		res.Set("vpc_TxnResponseCode", "7")
+		res.Set("vpc_Message", "Transaction not found")
+		return
+	}
+
+	if amount <= 0 || amount > txn.refundable() {
+		res.Set("vpc_TxnResponseCode", "5")
+		res.Set("vpc_Message", "Invalid amount")
+		return
+	}
+
+	s.seq++
+	txn.Refunded += amount
+
+	res.Set("vpc_Amount", strconv.FormatInt(amount, 10))
+	res.Set("vpc_RefundedAmount", strconv.FormatInt(txn.Refunded, 10))
+	res.Set("vpc_TransactionNo", fmt.Sprintf("%06d", s.seq))
+	res.Set("vpc_TxnResponseCode", "0")
+	res.Set("vpc_Message", "Approved")
+}
+
+func (s *Server) authorization(v url.Values, res url.Values) (*Transaction, bool) {
+	txn, ok := s.txnNos[v.Get("vpc_TransNo")]
+	if !ok || txn.Outcome != Approved || txn.Command != payment.CommandAuthorize {
+		res.Set("vpc_TxnResponseCode", "7")
+		res.Set("vpc_Message", "Authorization not found")
+		return nil, false
+	}
+
+	if txn.Voided {
+		res.Set("vpc_TxnResponseCode", "7")
+		res.Set("vpc_Message", "Authorization voided")
+		return nil, false
+	}
+
+	return txn, true
+}
+
+func (s *Server) capture(v url.Values, res url.Values) {
+	amount, err := strconv.ParseInt(v.Get("vpc_Amount"), 10, 64)
+	if err != nil {
+		res.Set("vpc_TxnResponseCode", "5")
+		res.Set("vpc_Message", "Invalid amount")
+		return
+	}
+
+	txn, ok := s.authorization(v, res)
+	if !ok {
+		return
+	}
+
+	if amount <= 0 || txn.Captured+amount > txn.Amount {
+		res.Set("vpc_TxnResponseCode", "5")
+		res.Set("vpc_Message", "Invalid amount")
+		return
+	}
+
+	s.seq++
+	txn.Captured += amount
+
+	res.Set("vpc_Amount", strconv.FormatInt(amount, 10))
+	res.Set("vpc_TransactionNo", fmt.Sprintf("%06d", s.seq))
+	res.Set("vpc_TxnResponseCode", "0")
+	res.Set("vpc_Message", "Approved")
+	setAuthorizationAmounts(txn, res)
+}
+
+func (s *Server) void(v url.Values, res url.Values) {
+	txn, ok := s.authorization(v, res)
+	if !ok {
+		return
+	}
+
+	s.seq++
+	txn.Voided = true
+
+	res.Set("vpc_TransactionNo", fmt.Sprintf("%06d", s.seq))
+	res.Set("vpc_TxnResponseCode", "0")
+	res.Set("vpc_Message", "Approved")
+	setAuthorizationAmounts(txn, res)
+}
+
+func setAuthorizationAmounts(txn *Transaction, res url.Values) {
+	res.Set("vpc_AuthorisedAmount", strconv.FormatInt(txn.Amount, 10))
+	res.Set("vpc_CapturedAmount", strconv.FormatInt(txn.Captured, 10))
+	res.Set("vpc_RefundedAmount", strconv.FormatInt(txn.Refunded, 10))
+}
+
+func addSecureHash(v url.Values, secureSecret string) error {
+	hash, err := payment.SecureHash(v, secureSecret)
+	if err != nil {
+		return err
+	}
+
+	v.Set(payment.VPCSecureHashKey, hash)
+	return nil
+}
+
+func message(channel payment.Channel, outcome Outcome) string {
+	rc, _ := payment.LookupResponseCode(channel, string(outcome))
+	return rc.Message.EN
+}
@@ -0,0 +1,236 @@
+package onepaytest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tranduythanh/payment"
+)
+
+func TestServer(t *testing.T) {
+	Convey("Server", t, func() {
+		gw := NewServer()
+		defer gw.Close()
+
+		params := func(ref string) *payment.CheckoutParams {
+			return &payment.CheckoutParams{
+				Amount:      100000,
+				OrderInfo:   "order " + ref,
+				MerchTxnRef: ref,
+				TicketNo:    "127.0.0.1",
+				Title:       "Checkout",
+				AgainLink:   "https://example.com/cart",
+			}
+		}
+
+		Convey("domestic checkout", func() {
+			op := payment.NewSandboxDomestic("https://example.com/callback")
+			op.Cfg.User = "op01"
+			op.Cfg.Password = "op123456"
+			op.Cfg = gw.Configure(op.Cfg)
+
+			gw.SetOutcome("dom-declined", Declined)
+			gw.SetOutcome("dom-cancel", UserCancel)
+			gw.SetOutcome("dom-timeout", Timeout)
+
+			for ref, code := range map[string]string{
+				"dom-approved": "0",
+				"dom-declined": "1",
+				"dom-cancel":   "99",
+				"dom-timeout":  "253",
+			} {
+				checkoutURL, err := op.BuildCheckoutURL(params(ref))
+				So(err, ShouldBeNil)
+
+				v, err := gw.Pay(checkoutURL)
+				So(err, ShouldBeNil)
+
+				resp, err := op.HandleCallback(v)
+				So(err, ShouldBeNil)
+				So(resp.VPCMerchTxnRef, ShouldEqual, ref)
+				So(resp.VPCTxnResponseCode, ShouldEqual, code)
+				So(resp.VPCAmount, ShouldEqual, 100000)
+				So(resp.TxnResponseMessage, ShouldResemble, payment.DomesticResponseCodes[code].Message)
+			}
+
+			Convey("queryDR", func() {
+				res, err := op.QueryDR(context.Background(), &payment.QueryDRAPIRequest{VPCMerchTxnRef: "dom-cancel"})
+				So(err, ShouldBeNil)
+				So(res.Exists(), ShouldBeTrue)
+				So(res.VPCAmount, ShouldEqual, 100000)
+				So(res.VPCOrderInfo, ShouldEqual, "order dom-cancel")
+				So(res.VPCTransactionNo, ShouldNotBeEmpty)
+				So(res.VPCTxnResponseCode, ShouldEqual, "99")
+				So(res.TxnResponseMessage, ShouldResemble, payment.DomesticResponseCodes["99"].Message)
+
+				res, err = op.QueryDR(context.Background(), &payment.QueryDRAPIRequest{VPCMerchTxnRef: "unknown"})
+				So(err, ShouldBeNil)
+				So(res.Exists(), ShouldBeFalse)
+			})
+
+			Convey("partial refund", func() {
+				txn, ok := gw.Transaction("dom-approved")
+				So(ok, ShouldBeTrue)
+
+				resp, err := op.Refund(context.Background(), &payment.RefundParams{
+					MerchTxnRef:   "dom-refund-1",
+					TransactionNo: txn.TransactionNo,
+					Amount:        40000,
+				})
+				So(err, ShouldBeNil)
+				So(resp.Approved(), ShouldBeTrue)
+				So(resp.VPCRefundedAmount, ShouldEqual, 40000)
+
+				resp, err = op.Refund(context.Background(), &payment.RefundParams{
+					MerchTxnRef:   "dom-refund-2",
+					TransactionNo: txn.TransactionNo,
+					Amount:        70000,
+				})
+				var decline *payment.DeclineError
+				So(errors.As(err, &decline), ShouldBeTrue)
+				So(decline.Code, ShouldEqual, "5")
+				So(resp.Approved(), ShouldBeFalse)
+				So(resp.VPCTxnResponseCode, ShouldEqual, "5")
+			})
+		})
+
+		Convey("international 3DS failure", func() {
+			op := payment.NewSandboxInternational("https://example.com/callback")
+			op.Cfg = gw.Configure(op.Cfg)
+
+			gw.SetOutcome("int-3ds", ThreeDSFailure)
+
+			checkoutURL, err := op.BuildCheckoutURL(params("int-3ds"))
+			So(err, ShouldBeNil)
+
+			v, err := gw.Pay(checkoutURL)
+			So(err, ShouldBeNil)
+
+			resp, err := op.HandleCallback(v)
+			So(err, ShouldBeNil)
+			So(resp.VPCTxnResponseCode, ShouldEqual, "F")
+			So(resp.VPC3DSstatus, ShouldEqual, "N")
+		})
+
+		Convey("international USD with cents", func() {
+			op := payment.NewSandboxInternational("https://example.com/callback")
+			op.Cfg.User = "op01"
+			op.Cfg.Password = "op123456"
+			op.Cfg = gw.Configure(op.Cfg)
+
+			p := params("int-usd")
+			p.Money = payment.Money{Amount: 1050, Currency: "USD"}
+
+			checkoutURL, err := op.BuildCheckoutURL(p)
+			So(err, ShouldBeNil)
+
+			v, err := gw.Pay(checkoutURL)
+			So(err, ShouldBeNil)
+			So(v.Get("vpc_Amount"), ShouldEqual, "1050")
+
+			resp, err := op.HandleCallback(v)
+			So(err, ShouldBeNil)
+			So(resp.Money, ShouldResemble, payment.Money{Amount: 1050, Currency: "USD"})
+			So(resp.Result().Money.String(), ShouldEqual, "10.50 USD")
+
+			res, err := op.Refund(context.Background(), &payment.RefundParams{
+				MerchTxnRef:   "int-usd-refund",
+				TransactionNo: resp.VPCTransactionNo,
+				Money:         payment.Money{Amount: 25, Currency: "USD"},
+			})
+			So(err, ShouldBeNil)
+			So(res.Money, ShouldResemble, payment.Money{Amount: 25, Currency: "USD"})
+			So(res.RefundedMoney.Amount, ShouldEqual, 25)
+		})
+
+		Convey("international authorize then capture", func() {
+			op := payment.NewSandboxInternational("https://example.com/callback")
+			op.Cfg.User = "op01"
+			op.Cfg.Password = "op123456"
+			op.Cfg = gw.Configure(op.Cfg)
+
+			p := params("int-auth")
+			p.Authorize = true
+
+			checkoutURL, err := op.BuildCheckoutURL(p)
+			So(err, ShouldBeNil)
+
+			v, err := gw.Pay(checkoutURL)
+			So(err, ShouldBeNil)
+
+			auth, err := op.HandleCallback(v)
+			So(err, ShouldBeNil)
+			So(auth.VPCCommand, ShouldEqual, payment.CommandAuthorize)
+
+			res, err := op.Capture(context.Background(), &payment.CaptureParams{
+				MerchTxnRef:   "int-capture-1",
+				TransactionNo: auth.VPCTransactionNo,
+				Amount:        30000,
+			})
+			So(err, ShouldBeNil)
+			So(res.Approved(), ShouldBeTrue)
+			So(res.VPCCapturedAmount, ShouldEqual, 30000)
+			So(res.Remaining(), ShouldEqual, 70000)
+
+			res, err = op.Void(context.Background(), &payment.VoidParams{
+				MerchTxnRef:   "int-void-1",
+				TransactionNo: auth.VPCTransactionNo,
+			})
+			So(err, ShouldBeNil)
+			So(res.Approved(), ShouldBeTrue)
+
+			res, err = op.Capture(context.Background(), &payment.CaptureParams{
+				MerchTxnRef:   "int-capture-2",
+				TransactionNo: auth.VPCTransactionNo,
+				Amount:        10000,
+			})
+			So(errors.Is(err, payment.ErrGatewayDecline), ShouldBeTrue)
+			So(res.Approved(), ShouldBeFalse)
+
+			Convey("USD capture keeps the cents", func() {
+				p := params("int-auth-usd")
+				p.Authorize = true
+				p.Money = payment.Money{Amount: 1050, Currency: "USD"}
+
+				checkoutURL, err := op.BuildCheckoutURL(p)
+				So(err, ShouldBeNil)
+
+				v, err := gw.Pay(checkoutURL)
+				So(err, ShouldBeNil)
+
+				auth, err := op.HandleCallback(v)
+				So(err, ShouldBeNil)
+
+				res, err := op.Capture(context.Background(), &payment.CaptureParams{
+					MerchTxnRef:   "int-capture-usd",
+					TransactionNo: auth.VPCTransactionNo,
+					Money:         payment.Money{Amount: 325, Currency: "USD"},
+				})
+				So(err, ShouldBeNil)
+				So(res.Money, ShouldResemble, payment.Money{Amount: 325, Currency: "USD"})
+				So(res.AuthorisedMoney, ShouldResemble, payment.Money{Amount: 1050, Currency: "USD"})
+				So(res.CapturedMoney, ShouldResemble, payment.Money{Amount: 325, Currency: "USD"})
+				So(res.RemainingMoney().String(), ShouldEqual, "7.25 USD")
+			})
+
+			Convey("domestic cannot authorize", func() {
+				_, err := payment.NewSandboxDomestic("https://example.com/callback").BuildCheckoutURL(p)
+				So(errors.Is(err, payment.ErrAuthorizeNotSupported), ShouldBeTrue)
+			})
+		})
+
+		Convey("rejects a forged checkout", func() {
+			op := payment.NewSandboxDomestic("https://example.com/callback")
+			op.Cfg = gw.Configure(op.Cfg)
+			op.Cfg.SecureSecret = "00112233445566778899AABBCCDDEEFF"
+
+			checkoutURL, err := op.BuildCheckoutURL(params("forged"))
+			So(err, ShouldBeNil)
+
+			_, err = gw.Pay(checkoutURL)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,95 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Order is what BuildCheckoutURL signed for a MerchTxnRef, a callback
+// must carry the same values.
+type Order struct {
+	Merchant  string
+	Money     Money
+	OrderInfo string
+}
+
+// OrderLookup finds the Order of a MerchTxnRef, it returns
+// ErrTransactionNotFound for a reference it never issued.
+type OrderLookup interface {
+	LookupOrder(ctx context.Context, merchTxnRef string) (*Order, error)
+}
+
+// OrderLookupFunc adapts a function to OrderLookup.
+type OrderLookupFunc func(ctx context.Context, merchTxnRef string) (*Order, error)
+
+// LookupOrder ...
+func (f OrderLookupFunc) LookupOrder(ctx context.Context, merchTxnRef string) (*Order, error) {
+	return f(ctx, merchTxnRef)
+}
+
+// OrdersFromStore looks orders up in the TransactionStore filled by
+// BuildCheckoutURL, merchant is Config.Merchant.
+func OrdersFromStore(store TransactionStore, merchant string) OrderLookup {
+	return OrderLookupFunc(func(ctx context.Context, merchTxnRef string) (*Order, error) {
+		txn, err := store.Get(ctx, merchTxnRef)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Order{
+			Merchant:  merchant,
+			Money:     Money{Amount: txn.Amount, Currency: txn.Currency},
+			OrderInfo: txn.OrderInfo,
+		}, nil
+	})
+}
+
+// verifyOrder compares the signed callback v with the order of its
+// MerchTxnRef, every mismatching field is reported.
+func verifyOrder(ctx context.Context, orders OrderLookup, v map[string][]string) error {
+	if orders == nil {
+		return nil
+	}
+
+	get := func(key string) string {
+		if values := v[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	order, err := orders.LookupOrder(ctx, get("vpc_MerchTxnRef"))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	mismatch := func(field, expected, actual string, sentinel error) {
+		errs = append(errs, &MismatchError{Field: field, Expected: expected, Actual: actual, Err: sentinel})
+	}
+
+	if order.Merchant != "" && get("vpc_Merchant") != order.Merchant {
+		mismatch("vpc_Merchant", order.Merchant, get("vpc_Merchant"), ErrMerchantMismatch)
+	}
+
+	expected, err := order.Money.gatewayAmount()
+	if err != nil {
+		return err
+	}
+	if get("vpc_Amount") != strconv.FormatInt(expected, 10) {
+		mismatch("vpc_Amount", strconv.FormatInt(expected, 10), get("vpc_Amount"), ErrAmountMismatch)
+	}
+
+	// the domestic gateway may leave the currency out
+	if currency := get("vpc_CurrencyCode"); currency != "" && !strings.EqualFold(currency, order.Money.Currency) {
+		mismatch("vpc_CurrencyCode", order.Money.Currency, currency, ErrCurrencyMismatch)
+	}
+
+	if order.OrderInfo != "" && get("vpc_OrderInfo") != order.OrderInfo {
+		mismatch("vpc_OrderInfo", order.OrderInfo, get("vpc_OrderInfo"), ErrOrderInfoMismatch)
+	}
+
+	return errors.Join(errs...)
+}
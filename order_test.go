@@ -0,0 +1,84 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOrderVerification(t *testing.T) {
+	Convey("Order verification", t, func() {
+		op := NewSandboxInternational("https://example.com/callback")
+		op.Store = NewMemoryStore()
+		op.Orders = OrdersFromStore(op.Store, op.Cfg.Merchant)
+
+		checkoutURL, err := op.BuildCheckoutURL(&CheckoutParams{
+			Money:       Money{Amount: 1050, Currency: "USD"},
+			OrderInfo:   "order 1",
+			MerchTxnRef: "ref-1",
+			TicketNo:    "127.0.0.1",
+			Title:       "Checkout",
+			AgainLink:   "https://example.com/cart",
+		})
+		So(err, ShouldBeNil)
+
+		u, err := url.Parse(checkoutURL)
+		So(err, ShouldBeNil)
+
+		callback := func(change func(v url.Values)) url.Values {
+			q := u.Query()
+			v := url.Values{}
+			for _, key := range []string{"vpc_MerchTxnRef", "vpc_Merchant", "vpc_Amount", "vpc_OrderInfo"} {
+				v.Set(key, q.Get(key))
+			}
+			v.Set("vpc_CurrencyCode", q.Get("vpc_Currency"))
+			v.Set("vpc_TxnResponseCode", "0")
+			change(v)
+			addSecureHash(&v, op.Cfg.SecureSecret)
+			return v
+		}
+
+		Convey("accepts the signed order", func() {
+			resp, err := op.HandleCallback(callback(func(v url.Values) {}))
+			So(err, ShouldBeNil)
+			So(resp.Money.String(), ShouldEqual, "10.50 USD")
+		})
+
+		Convey("reports every mismatching field", func() {
+			_, err := op.HandleCallback(callback(func(v url.Values) {
+				v.Set("vpc_Amount", "100")
+				v.Set("vpc_CurrencyCode", "VND")
+			}))
+			So(errors.Is(err, ErrOrderMismatch), ShouldBeTrue)
+			So(errors.Is(err, ErrAmountMismatch), ShouldBeTrue)
+			So(errors.Is(err, ErrCurrencyMismatch), ShouldBeTrue)
+			So(errors.Is(err, ErrMerchantMismatch), ShouldBeFalse)
+
+			var merr *MismatchError
+			So(errors.As(err, &merr), ShouldBeTrue)
+			So(merr.Expected, ShouldEqual, "1050")
+			So(merr.Actual, ShouldEqual, "100")
+
+			_, err = op.HandleCallback(callback(func(v url.Values) {
+				v.Set("vpc_Merchant", "OTHER")
+				v.Set("vpc_OrderInfo", "order 2")
+			}))
+			So(errors.Is(err, ErrMerchantMismatch), ShouldBeTrue)
+			So(errors.Is(err, ErrOrderInfoMismatch), ShouldBeTrue)
+
+			txn, err := op.Store.Get(context.Background(), "ref-1")
+			So(err, ShouldBeNil)
+			So(txn.State, ShouldEqual, StatePending)
+		})
+
+		Convey("rejects an unknown reference", func() {
+			_, err := op.HandleCallback(callback(func(v url.Values) {
+				v.Set("vpc_MerchTxnRef", "ref-2")
+			}))
+			So(errors.Is(err, ErrTransactionNotFound), ShouldBeTrue)
+		})
+	})
+}
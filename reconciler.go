@@ -0,0 +1,384 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defines reconciler defaults
+const (
+	// DefaultReconcileMinAge follows OnePay's advice to call QueryDR only
+	// 15 minutes after the checkout.
+	DefaultReconcileMinAge      = 15 * time.Minute
+	DefaultReconcileInterval    = time.Minute
+	DefaultReconcileConcurrency = 4
+	DefaultReconcileBatchSize   = 100
+	DefaultReconcileMaxBackoff  = time.Hour
+	// DefaultReconcileExpiry is well past the timeout of the checkout page
+	DefaultReconcileExpiry = 24 * time.Hour
+	// DefaultReconcileMaxAge leaves ONEPAY days to settle a pending payment
+	DefaultReconcileMaxAge = 7 * 24 * time.Hour
+)
+
+// ReconcileHandler is called once for every transaction the Reconciler moves
+// out of StatePending. txn is the stored transaction after the update.
+type ReconcileHandler func(ctx context.Context, txn *Transaction, res *QueryDRAPIResponse) error
+
+// Reconciler polls QueryDR for pending transactions whose callback never
+// arrived and settles them in the TransactionStore.
+type Reconciler struct {
+	Store    TransactionStore
+	Gateways map[Channel]Gateway
+	Handler  ReconcileHandler
+
+	// MinAge, Interval, Concurrency and BatchSize fall back to the
+	// DefaultReconcile* values when zero.
+	MinAge      time.Duration
+	Interval    time.Duration
+	Concurrency int
+	BatchSize   int
+
+	// A transaction still pending, or whose QueryDR failed, is retried after
+	// Interval, then twice as late each time up to MaxBackoff.
+	MaxBackoff time.Duration
+
+	// A transaction ONEPAY still has no record of Expiry after the checkout,
+	// DefaultReconcileExpiry when zero, was abandoned: it is moved to
+	// StateExpired so it stops taking a place in the batches.
+	Expiry time.Duration
+
+	// A transaction ONEPAY still reports pending MaxAge after the checkout,
+	// DefaultReconcileMaxAge when zero, is moved to StateExpired as well.
+	MaxAge time.Duration
+
+	// OnError receives QueryDR, store and handler errors, may be nil.
+	OnError func(txn *Transaction, err error)
+
+	// Locker should be the Locker of the clients, the shared in-process
+	// MutexLocker when nil.
+	Locker Locker
+
+	mu      sync.Mutex
+	retries map[string]*reconcileRetry
+}
+
+type reconcileRetry struct {
+	attempts int
+	next     time.Time
+}
+
+// NewReconciler ...
+func NewReconciler(store TransactionStore, handler ReconcileHandler, gateways ...Gateway) *Reconciler {
+	r := &Reconciler{
+		Store:    store,
+		Gateways: map[Channel]Gateway{},
+		Handler:  handler,
+	}
+
+	for _, gw := range gateways {
+		r.Gateways[gw.Channel()] = gw
+	}
+
+	return r
+}
+
+// Run calls RunOnce every Interval until ctx is done.
+func (r *Reconciler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+
+	for {
+		err := r.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.reportError(nil, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce reconciles one batch of pending transactions older than MinAge.
+// The transactions backing off are skipped without taking a place in the
+// batch, so they do not hold back the newer ones.
+func (r *Reconciler) RunOnce(ctx context.Context) error {
+	now := time.Now()
+
+	// list past the transactions backing off, they come first when older
+	limit := r.batchSize() + r.waiting(now)
+
+	txns, err := r.Store.ListPending(ctx, now.Add(-r.minAge()), limit)
+	if err != nil {
+		return err
+	}
+
+	if len(txns) < limit {
+		// every pending transaction is listed, drop the retries of the
+		// ones settled meanwhile by a callback
+		r.prune(txns)
+	}
+
+	sem := make(chan struct{}, r.concurrency())
+	var wg sync.WaitGroup
+
+	batch := 0
+	for _, txn := range txns {
+		if batch == r.batchSize() {
+			break
+		}
+		if !r.due(txn.MerchTxnRef, now) {
+			continue
+		}
+		batch++
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(txn *Transaction) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := r.reconcile(ctx, txn)
+			if err != nil {
+				r.reportError(txn, err)
+			}
+		}(txn)
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, txn *Transaction) error {
+	gw, ok := r.Gateways[txn.Channel]
+	if !ok {
+		r.backoff(txn.MerchTxnRef)
+		return fmt.Errorf("No gateway for channel %q", txn.Channel)
+	}
+
+	res, err := gw.QueryDR(ctx, &QueryDRAPIRequest{VPCMerchTxnRef: txn.MerchTxnRef})
+	if err != nil {
+		r.backoff(txn.MerchTxnRef)
+		return err
+	}
+
+	if !res.Exists() && time.Since(txn.CreatedAt) >= r.expiry() {
+		return r.expire(ctx, txn, res)
+	}
+
+	if !res.Exists() {
+		r.backoff(txn.MerchTxnRef)
+		return nil
+	}
+
+	if !stateFromResponseCode(txn.Channel, res.VPCTxnResponseCode).Final() {
+		if time.Since(txn.CreatedAt) >= r.maxAge() {
+			return r.expire(ctx, txn, res)
+		}
+
+		r.backoff(txn.MerchTxnRef)
+		return nil
+	}
+
+	unlock, err := lockTransaction(ctx, r.Locker, txn.MerchTxnRef)
+	if err != nil {
+		r.backoff(txn.MerchTxnRef)
+		return err
+	}
+	defer unlock()
+
+	// QueryDR of a client sharing the store has settled it already
+	moved, err := settleTransaction(ctx, r.Store, txn.Channel, txn.MerchTxnRef, res.VPCTransactionNo, res.VPCTxnResponseCode, nil)
+	if err != nil {
+		r.backoff(txn.MerchTxnRef)
+		return err
+	}
+
+	r.forget(txn.MerchTxnRef)
+
+	// a callback or an IPN settled and fulfilled it first
+	if !moved && !res.settled {
+		return nil
+	}
+
+	settled, err := r.Store.Get(ctx, txn.MerchTxnRef)
+	if err != nil {
+		return err
+	}
+
+	if r.Handler == nil {
+		return nil
+	}
+
+	return r.Handler(ctx, settled, res)
+}
+
+func (r *Reconciler) expire(ctx context.Context, txn *Transaction, res *QueryDRAPIResponse) error {
+	unlock, err := lockTransaction(ctx, r.Locker, txn.MerchTxnRef)
+	if err != nil {
+		r.backoff(txn.MerchTxnRef)
+		return err
+	}
+	defer unlock()
+
+	moved, err := expireTransaction(ctx, r.Store, txn.MerchTxnRef)
+	if err != nil {
+		r.backoff(txn.MerchTxnRef)
+		return err
+	}
+
+	r.forget(txn.MerchTxnRef)
+
+	if !moved {
+		return nil
+	}
+
+	expired, err := r.Store.Get(ctx, txn.MerchTxnRef)
+	if err != nil {
+		return err
+	}
+
+	if r.Handler == nil {
+		return nil
+	}
+
+	return r.Handler(ctx, expired, res)
+}
+
+func (r *Reconciler) due(merchTxnRef string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	retry, ok := r.retries[merchTxnRef]
+	return !ok || !now.Before(retry.next)
+}
+
+// waiting counts the transactions backing off until after now.
+func (r *Reconciler) waiting(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, retry := range r.retries {
+		if now.Before(retry.next) {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Reconciler) backoff(merchTxnRef string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.retries == nil {
+		r.retries = map[string]*reconcileRetry{}
+	}
+
+	retry, ok := r.retries[merchTxnRef]
+	if !ok {
+		retry = &reconcileRetry{}
+		r.retries[merchTxnRef] = retry
+	}
+
+	delay := r.interval()
+	for i := 0; i < retry.attempts && delay < r.maxBackoff(); i++ {
+		delay *= 2
+	}
+	if delay > r.maxBackoff() {
+		delay = r.maxBackoff()
+	}
+
+	retry.attempts++
+	retry.next = time.Now().Add(delay)
+}
+
+func (r *Reconciler) forget(merchTxnRef string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.retries, merchTxnRef)
+}
+
+// prune drops the retries of the transactions no longer pending.
+func (r *Reconciler) prune(pending []*Transaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keep := make(map[string]bool, len(pending))
+	for _, txn := range pending {
+		keep[txn.MerchTxnRef] = true
+	}
+
+	for ref := range r.retries {
+		if !keep[ref] {
+			delete(r.retries, ref)
+		}
+	}
+}
+
+func (r *Reconciler) reportError(txn *Transaction, err error) {
+	if r.OnError != nil {
+		r.OnError(txn, err)
+	}
+}
+
+func (r *Reconciler) minAge() time.Duration {
+	if r.MinAge > 0 {
+		return r.MinAge
+	}
+	return DefaultReconcileMinAge
+}
+
+func (r *Reconciler) interval() time.Duration {
+	if r.Interval > 0 {
+		return r.Interval
+	}
+	return DefaultReconcileInterval
+}
+
+func (r *Reconciler) concurrency() int {
+	if r.Concurrency > 0 {
+		return r.Concurrency
+	}
+	return DefaultReconcileConcurrency
+}
+
+func (r *Reconciler) batchSize() int {
+	if r.BatchSize > 0 {
+		return r.BatchSize
+	}
+	return DefaultReconcileBatchSize
+}
+
+func (r *Reconciler) maxBackoff() time.Duration {
+	if r.MaxBackoff > 0 {
+		return r.MaxBackoff
+	}
+	return DefaultReconcileMaxBackoff
+}
+
+func (r *Reconciler) expiry() time.Duration {
+	if r.Expiry > 0 {
+		return r.Expiry
+	}
+	return DefaultReconcileExpiry
+}
+
+func (r *Reconciler) maxAge() time.Duration {
+	if r.MaxAge > 0 {
+		return r.MaxAge
+	}
+	return DefaultReconcileMaxAge
+}
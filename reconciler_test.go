@@ -0,0 +1,181 @@
+package payment_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tranduythanh/payment"
+	"github.com/tranduythanh/payment/onepaytest"
+)
+
+func TestReconciler(t *testing.T) {
+	Convey("Reconciler", t, func() {
+		gw := onepaytest.NewServer()
+		defer gw.Close()
+
+		store := payment.NewMemoryStore()
+
+		op := payment.NewSandboxDomestic("https://example.com/callback")
+		op.Cfg.User = "op01"
+		op.Cfg.Password = "op123456"
+		op.Cfg = gw.Configure(op.Cfg)
+		op.Store = store
+
+		checkout := func(ref string) string {
+			checkoutURL, err := op.BuildCheckoutURL(&payment.CheckoutParams{
+				Amount:      100000,
+				OrderInfo:   "order " + ref,
+				MerchTxnRef: ref,
+				TicketNo:    "127.0.0.1",
+				Title:       "Checkout",
+				AgainLink:   "https://example.com/cart",
+			})
+			So(err, ShouldBeNil)
+			return checkoutURL
+		}
+
+		// the customer pays but the callback is lost
+		_, err := gw.Pay(checkout("paid"))
+		So(err, ShouldBeNil)
+
+		gw.SetOutcome("cancelled", onepaytest.UserCancel)
+		_, err = gw.Pay(checkout("cancelled"))
+		So(err, ShouldBeNil)
+
+		// the customer has not reached the gateway yet
+		abandonedURL := checkout("abandoned")
+
+		var mu sync.Mutex
+		settled := map[string]payment.TransactionState{}
+
+		r := payment.NewReconciler(store, func(ctx context.Context, txn *payment.Transaction, res *payment.QueryDRAPIResponse) error {
+			mu.Lock()
+			defer mu.Unlock()
+			settled[txn.MerchTxnRef] = txn.State
+			return nil
+		}, op)
+		r.MinAge = time.Nanosecond
+		r.Interval = time.Hour
+		r.OnError = func(txn *payment.Transaction, err error) {
+			t.Error(err)
+		}
+
+		time.Sleep(time.Millisecond)
+		So(r.RunOnce(context.Background()), ShouldBeNil)
+
+		So(settled, ShouldResemble, map[string]payment.TransactionState{
+			"paid":      payment.StateApproved,
+			"cancelled": payment.StateFailed,
+		})
+
+		pending, err := store.ListPending(context.Background(), time.Now(), 0)
+		So(err, ShouldBeNil)
+		So(len(pending), ShouldEqual, 1)
+		So(pending[0].MerchTxnRef, ShouldEqual, "abandoned")
+
+		Convey("backs off transactions still pending", func() {
+			_, err := gw.Pay(abandonedURL)
+			So(err, ShouldBeNil)
+
+			settled = map[string]payment.TransactionState{}
+			So(r.RunOnce(context.Background()), ShouldBeNil)
+
+			// the next QueryDR for "abandoned" waits for Interval
+			So(settled, ShouldBeEmpty)
+		})
+
+		Convey("leaves a transaction settled by a racing callback alone", func() {
+			v, err := gw.Pay(checkout("raced"))
+			So(err, ShouldBeNil)
+
+			settled = map[string]payment.TransactionState{}
+
+			var callbackErr error
+			racing := payment.NewReconciler(store, r.Handler, racingGateway{Gateway: op, callback: func() {
+				_, callbackErr = op.HandleCallback(v)
+			}})
+			racing.MinAge = time.Nanosecond
+			So(racing.RunOnce(context.Background()), ShouldBeNil)
+
+			So(callbackErr, ShouldBeNil)
+			So(settled, ShouldBeEmpty)
+
+			txn, err := store.Get(context.Background(), "raced")
+			So(err, ShouldBeNil)
+			So(txn.State, ShouldEqual, payment.StateApproved)
+		})
+
+		Convey("does not let older transactions backing off hold back newer ones", func() {
+			gw.SetOutcome("stuck", "M")
+			_, err := gw.Pay(checkout("stuck"))
+			So(err, ShouldBeNil)
+
+			time.Sleep(time.Millisecond)
+			_, err = gw.Pay(checkout("late"))
+			So(err, ShouldBeNil)
+
+			settled = map[string]payment.TransactionState{}
+
+			paged := payment.NewReconciler(store, r.Handler, op)
+			paged.MinAge = time.Nanosecond
+			paged.Interval = time.Hour
+			paged.BatchSize = 1
+			for i := 0; i < 5; i++ {
+				So(paged.RunOnce(context.Background()), ShouldBeNil)
+			}
+
+			So(settled, ShouldResemble, map[string]payment.TransactionState{
+				"late": payment.StateApproved,
+			})
+
+			Convey("and expires them after MaxAge", func() {
+				paged = payment.NewReconciler(store, r.Handler, op)
+				paged.MinAge = time.Nanosecond
+				paged.MaxAge = time.Nanosecond
+				So(paged.RunOnce(context.Background()), ShouldBeNil)
+
+				So(settled["stuck"], ShouldEqual, payment.StateExpired)
+
+				pending, err := store.ListPending(context.Background(), time.Now(), 0)
+				So(err, ShouldBeNil)
+				So(len(pending), ShouldEqual, 1)
+				So(pending[0].MerchTxnRef, ShouldEqual, "abandoned")
+			})
+		})
+
+		Convey("expires checkouts ONEPAY never heard of", func() {
+			settled = map[string]payment.TransactionState{}
+
+			expirer := payment.NewReconciler(store, r.Handler, op)
+			expirer.MinAge = time.Nanosecond
+			expirer.Expiry = time.Nanosecond
+			expirer.BatchSize = 1
+			So(expirer.RunOnce(context.Background()), ShouldBeNil)
+
+			So(settled, ShouldResemble, map[string]payment.TransactionState{
+				"abandoned": payment.StateExpired,
+			})
+
+			pending, err := store.ListPending(context.Background(), time.Now(), 0)
+			So(err, ShouldBeNil)
+			So(pending, ShouldBeEmpty)
+		})
+	})
+}
+
+// racingGateway delivers the callback of a payment while the Reconciler
+// queries it.
+type racingGateway struct {
+	payment.Gateway
+	callback func()
+}
+
+func (g racingGateway) QueryDR(ctx context.Context, request *payment.QueryDRAPIRequest) (*payment.QueryDRAPIResponse, error) {
+	if request.VPCMerchTxnRef == "raced" {
+		g.callback()
+	}
+	return g.Gateway.QueryDR(ctx, request)
+}
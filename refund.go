@@ -0,0 +1,134 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// RefundParams ...
+type RefundParams struct {
+	// MerchTxnRef must be unique per refund, it is not the reference of the
+	// original payment.
+	MerchTxnRef string `validate:"required,max=40"`
+	// TransactionNo is the vpc_TransactionNo of the payment being refunded.
+	TransactionNo string `validate:"required"`
+	// Money may be lower than the paid amount for a partial refund, its
+	// Currency defaults to the Currency of the client.
+	Money Money `validate:"-"`
+	// Amount is in whole units, ignored when Money is set.
+	//
+	// Deprecated: use Money, Amount cannot hold cents.
+	Amount int64 `validate:"omitempty,gt=0,lte=9999999999"`
+}
+
+// RefundResponse ...
+type RefundResponse struct {
+	VPCCommand         string `json:"vpc_Command" query:"vpc_Command" schema:"vpc_Command"`
+	VPCVersion         string `json:"vpc_Version" query:"vpc_Version" schema:"vpc_Version"`
+	VPCMerchant        string `json:"vpc_Merchant" query:"vpc_Merchant" schema:"vpc_Merchant"`
+	VPCMerchTxnRef     string `json:"vpc_MerchTxnRef" query:"vpc_MerchTxnRef" schema:"vpc_MerchTxnRef"`
+	VPCTransactionNo   string `json:"vpc_TransactionNo" query:"vpc_TransactionNo" schema:"vpc_TransactionNo"`
+	VPCAmount          int64  `json:"vpc_Amount" query:"vpc_Amount" schema:"vpc_Amount"`
+	VPCRefundedAmount  int64  `json:"vpc_RefundedAmount" query:"vpc_RefundedAmount" schema:"vpc_RefundedAmount"`
+	VPCMessage         string `json:"vpc_Message" query:"vpc_Message" schema:"vpc_Message"`
+	VPCTxnResponseCode string `json:"vpc_TxnResponseCode" query:"vpc_TxnResponseCode" schema:"vpc_TxnResponseCode"`
+	VPCSecureHash      string `json:"vpc_SecureHash" query:"vpc_SecureHash" schema:"vpc_SecureHash"`
+
+	TxnResponseMessage ErrorMessageLocale `json:"txnResponseCode" query:"txnResponseCode" schema:"txnResponseCode"`
+
+	// Money and RefundedMoney are the exact VPCAmount and VPCRefundedAmount
+	Money         Money `json:"money" query:"-" schema:"-"`
+	RefundedMoney Money `json:"refunded_money" query:"-" schema:"-"`
+
+	// channel picks the response code table, set by the client
+	channel Channel
+	// currency is the one of the refund, the gateway does not send it
+	currency string
+}
+
+// PostProcess ...
+func (r *RefundResponse) PostProcess() {
+	r.Money = moneyFromGateway(r.VPCAmount, r.currency)
+	r.RefundedMoney = moneyFromGateway(r.VPCRefundedAmount, r.currency)
+	r.VPCAmount = r.VPCAmount / 100
+	r.VPCRefundedAmount = r.VPCRefundedAmount / 100
+	r.TxnResponseMessage = responseMessage(r.channel, r.VPCTxnResponseCode)
+}
+
+// Approved ...
+func (r *RefundResponse) Approved() bool {
+	return r.VPCTxnResponseCode == "0"
+}
+
+func refund(ctx context.Context, cfg *Config, channel Channel, currency string, params *RefundParams) (*RefundResponse, error) {
+	if cfg == nil {
+		return nil, ErrNilConfig
+	}
+
+	err := checkCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateStruct(params)
+	if err != nil {
+		return nil, err
+	}
+
+	money, err := resolveMoney(params.Amount, params.Money, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := money.gatewayAmount()
+	if err != nil {
+		return nil, err
+	}
+
+	v := url.Values{}
+
+	v.Add("vpc_Command", "refund")
+	v.Add("vpc_Version", "1")
+	v.Add("vpc_Merchant", cfg.Merchant)
+	v.Add("vpc_AccessCode", cfg.AccessCode)
+	v.Add("vpc_MerchTxnRef", params.MerchTxnRef)
+	v.Add("vpc_TransNo", params.TransactionNo)
+	v.Add("vpc_Amount", strconv.FormatInt(amount, 10))
+	v.Add("vpc_User", cfg.User)
+	v.Add("vpc_Password", cfg.Password)
+
+	res, err := requestDPS(ctx, cfg, http.MethodPost, v)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp = &RefundResponse{channel: channel, currency: money.Currency}
+	err = decodeDPSResponse(res, cfg, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.PostProcess()
+
+	return resp, declineError(channel, resp.VPCTxnResponseCode)
+}
+
+// checkCredentials makes sure cfg has the User and Password of the DPS
+// commands before anything is sent.
+func checkCredentials(cfg *Config) error {
+	var fields []FieldError
+	if cfg.User == "" {
+		fields = append(fields, FieldError{Field: "user", Tag: "required", Message: "is required"})
+	}
+	if cfg.Password == "" {
+		fields = append(fields, FieldError{Field: "password", Tag: "required", Message: "is required"})
+	}
+
+	if len(fields) > 0 {
+		return &ConfigError{Fields: fields}
+	}
+
+	return nil
+}
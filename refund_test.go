@@ -0,0 +1,94 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRefund(t *testing.T) {
+	Convey("Refund", t, func() {
+		op := NewSandboxInternational("https://example.com/callback")
+		op.Currency = "USD"
+		op.Cfg.User = "op01"
+		op.Cfg.Password = "op123456"
+
+		var sent url.Values
+		answer := func(code string, refunded string) {
+			op.Cfg.HTTPClient = &http.Client{
+				Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					body, _ := io.ReadAll(req.Body)
+					sent, _ = url.ParseQuery(string(body))
+
+					v := url.Values{}
+					v.Set("vpc_Command", "refund")
+					v.Set("vpc_MerchTxnRef", sent.Get("vpc_MerchTxnRef"))
+					v.Set("vpc_TransactionNo", sent.Get("vpc_TransNo"))
+					v.Set("vpc_Amount", sent.Get("vpc_Amount"))
+					v.Set("vpc_RefundedAmount", refunded)
+					v.Set("vpc_TxnResponseCode", code)
+					addSecureHash(&v, op.Cfg.SecureSecret)
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(strings.NewReader(v.Encode())),
+					}, nil
+				}),
+			}
+		}
+
+		params := &RefundParams{
+			MerchTxnRef:   "refund-1",
+			TransactionNo: "1",
+			Money:         Money{Amount: 325, Currency: "USD"},
+		}
+
+		Convey("refunds part of a payment", func() {
+			answer("0", "325")
+
+			res, err := op.Refund(context.Background(), params)
+			So(err, ShouldBeNil)
+			So(res.Approved(), ShouldBeTrue)
+			So(sent.Get("vpc_Command"), ShouldEqual, "refund")
+			So(sent.Get("vpc_Amount"), ShouldEqual, "325")
+			So(sent.Get("vpc_User"), ShouldEqual, "op01")
+			So(res.Money, ShouldResemble, Money{Amount: 325, Currency: "USD"})
+			So(res.RefundedMoney.String(), ShouldEqual, "3.25 USD")
+		})
+
+		Convey("returns the response and a *DeclineError on a decline", func() {
+			answer("5", "0")
+
+			res, err := op.Refund(context.Background(), params)
+			var derr *DeclineError
+			So(errors.As(err, &derr), ShouldBeTrue)
+			So(errors.Is(err, ErrGatewayDecline), ShouldBeTrue)
+			So(derr.Code, ShouldEqual, "5")
+			So(derr.Message.EN, ShouldEqual, "Insufficient funds")
+			So(res, ShouldNotBeNil)
+			So(res.Approved(), ShouldBeFalse)
+		})
+
+		Convey("requires User and Password", func() {
+			answer("0", "325")
+			sent = nil
+			op.Cfg.User = ""
+			op.Cfg.Password = ""
+
+			_, err := op.Refund(context.Background(), params)
+			var cerr *ConfigError
+			So(errors.As(err, &cerr), ShouldBeTrue)
+			So(errors.Is(err, ErrValidation), ShouldBeTrue)
+			So(cerr.Fields, ShouldHaveLength, 2)
+			So(cerr.Fields[0].Field, ShouldEqual, "user")
+			So(cerr.Fields[1].Field, ShouldEqual, "password")
+			So(sent, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,135 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// DefaultDedupTTL is how long a processed callback is remembered.
+const DefaultDedupTTL = 7 * 24 * time.Hour
+
+// SeenStore remembers the callbacks already processed. Implementations
+// shared by several instances (Redis SET NX, a unique SQL key, ...) make
+// LoadOrStore atomic.
+type SeenStore interface {
+	// Load returns the value stored under key, if any.
+	Load(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// LoadOrStore returns the value already stored under key with loaded
+	// true, otherwise it stores value for ttl.
+	LoadOrStore(ctx context.Context, key string, value []byte, ttl time.Duration) (actual []byte, loaded bool, err error)
+}
+
+// Dedup makes HandleCallback report a callback already processed, keyed
+// on vpc_MerchTxnRef and vpc_TransactionNo, with ErrAlreadyProcessed and
+// the response of the first time. Browser returns and IPNs share the key,
+// the IPN following the return of a payment is confirmed without calling
+// its handler again.
+type Dedup struct {
+	Store SeenStore
+	// TTL defaults to DefaultDedupTTL
+	TTL time.Duration
+}
+
+// NewDedup ...
+func NewDedup(store SeenStore, ttl time.Duration) *Dedup {
+	return &Dedup{Store: store, TTL: ttl}
+}
+
+func (d *Dedup) key(merchTxnRef, transactionNo string) string {
+	return "onepay:" + merchTxnRef + ":" + transactionNo
+}
+
+// load decodes the first response into resp when the callback has been
+// processed already.
+func (d *Dedup) load(ctx context.Context, merchTxnRef, transactionNo string, resp interface{}) (bool, error) {
+	value, ok, err := d.Store.Load(ctx, d.key(merchTxnRef, transactionNo))
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, json.Unmarshal(value, resp)
+}
+
+// remember stores resp, or decodes the response stored meanwhile by a
+// concurrent callback into it.
+func (d *Dedup) remember(ctx context.Context, merchTxnRef, transactionNo string, resp interface{}) (bool, error) {
+	value, err := json.Marshal(resp)
+	if err != nil {
+		return false, err
+	}
+
+	ttl := d.TTL
+	if ttl <= 0 {
+		ttl = DefaultDedupTTL
+	}
+
+	actual, loaded, err := d.Store.LoadOrStore(ctx, d.key(merchTxnRef, transactionNo), value, ttl)
+	if err != nil || !loaded {
+		return false, err
+	}
+
+	return true, json.Unmarshal(actual, resp)
+}
+
+// MemorySeenStore is a SeenStore for tests and single instance services.
+type MemorySeenStore struct {
+	mu      sync.Mutex
+	entries map[string]seenEntry
+	now     func() time.Time
+}
+
+type seenEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemorySeenStore ...
+func NewMemorySeenStore() *MemorySeenStore {
+	return &MemorySeenStore{entries: map[string]seenEntry{}}
+}
+
+func (s *MemorySeenStore) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// Load ...
+func (s *MemorySeenStore) Load(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || !entry.expiresAt.After(s.clock()) {
+		return nil, false, nil
+	}
+
+	return entry.value, true, nil
+}
+
+// LoadOrStore ...
+func (s *MemorySeenStore) LoadOrStore(ctx context.Context, key string, value []byte, ttl time.Duration) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+
+	entry, ok := s.entries[key]
+	if ok && entry.expiresAt.After(now) {
+		return entry.value, true, nil
+	}
+
+	// drop the expired entries while holding the lock
+	for k, e := range s.entries {
+		if !e.expiresAt.After(now) {
+			delete(s.entries, k)
+		}
+	}
+
+	s.entries[key] = seenEntry{value: value, expiresAt: now.Add(ttl)}
+
+	return value, false, nil
+}
@@ -0,0 +1,108 @@
+package payment
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDedup(t *testing.T) {
+	Convey("Dedup", t, func() {
+		store := NewMemorySeenStore()
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		store.now = func() time.Time { return now }
+
+		op := NewSandboxDomestic("https://example.com/callback")
+		op.Dedup = NewDedup(store, time.Hour)
+
+		callback := func(transNo, code string) url.Values {
+			v := url.Values{}
+			v.Set("vpc_Command", "pay")
+			v.Set("vpc_Merchant", op.Cfg.Merchant)
+			v.Set("vpc_MerchTxnRef", "ref-1")
+			v.Set("vpc_TransactionNo", transNo)
+			v.Set("vpc_Amount", "10000000")
+			v.Set("vpc_TxnResponseCode", code)
+			addSecureHash(&v, op.Cfg.SecureSecret)
+			return v
+		}
+
+		Convey("returns the first response of a replayed callback", func() {
+			resp, err := op.HandleCallback(callback("1", "0"))
+			So(err, ShouldBeNil)
+			So(resp.Status(), ShouldEqual, StatusApproved)
+
+			again, err := op.HandleCallback(callback("1", "0"))
+			So(errors.Is(err, ErrAlreadyProcessed), ShouldBeTrue)
+			So(again.VPCMerchTxnRef, ShouldEqual, "ref-1")
+			So(again.VPCAmount, ShouldEqual, 100000)
+			So(again.Status(), ShouldEqual, StatusApproved)
+		})
+
+		Convey("keys on the transaction number", func() {
+			_, err := op.HandleCallback(callback("1", "0"))
+			So(err, ShouldBeNil)
+
+			_, err = op.HandleCallback(callback("2", "0"))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("forgets a callback after the TTL", func() {
+			_, err := op.HandleCallback(callback("1", "0"))
+			So(err, ShouldBeNil)
+
+			now = now.Add(time.Hour)
+			_, err = op.HandleCallback(callback("1", "0"))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("lets IPN retries through when the handler fails", func() {
+			calls := 0
+			fail := true
+			h := op.IPNHandler(func(resp *DomesticResponse) error {
+				calls++
+				if fail {
+					return errors.New("db down")
+				}
+				return nil
+			})
+
+			serve := func() string {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ipn?"+callback("1", "0").Encode(), nil))
+				return rec.Body.String()
+			}
+
+			So(serve(), ShouldEqual, IPNConfirmFail)
+
+			fail = false
+			So(serve(), ShouldEqual, IPNConfirmSuccess)
+			So(serve(), ShouldEqual, IPNConfirmSuccess)
+			So(calls, ShouldEqual, 2)
+		})
+
+		Convey("confirms the IPN following the browser return without fn", func() {
+			_, err := op.HandleCallback(callback("1", "0"))
+			So(err, ShouldBeNil)
+
+			calls := 0
+			h := op.IPNHandler(func(resp *DomesticResponse) error {
+				calls++
+				return nil
+			})
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ipn?"+callback("1", "0").Encode(), nil))
+			So(rec.Body.String(), ShouldEqual, IPNConfirmSuccess)
+			So(calls, ShouldEqual, 0)
+
+			_, err = op.HandleCallback(callback("1", "0"))
+			So(errors.Is(err, ErrAlreadyProcessed), ShouldBeTrue)
+		})
+	})
+}
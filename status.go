@@ -0,0 +1,96 @@
+package payment
+
+// Status classifies a vpc_TxnResponseCode so callers do not have to know
+// the gateway codes.
+type Status string
+
+// Defines the statuses of a transaction
+const (
+	StatusApproved  Status = "approved"
+	StatusDeclined  Status = "declined"
+	StatusCancelled Status = "cancelled"
+	StatusExpired   Status = "expired"
+	StatusPending   Status = "pending"
+	StatusUnknown   Status = "unknown"
+)
+
+// StatusOf classifies a vpc_TxnResponseCode of either channel, codes
+// missing from both tables are StatusUnknown.
+//
+// Deprecated: use LookupResponseCode, a code may differ between channels.
+func StatusOf(code string) Status {
+	return lookupEitherChannel(code).Status
+}
+
+// Retryable reports whether the customer may try again after a
+// vpc_TxnResponseCode of either channel, false for unknown codes.
+//
+// Deprecated: use LookupResponseCode, a code may differ between channels.
+func Retryable(code string) bool {
+	return lookupEitherChannel(code).Retryable
+}
+
+// lookupEitherChannel prefers the domestic table, like the single table
+// StatusOf and Retryable used to read.
+func lookupEitherChannel(code string) ResponseCode {
+	rc, ok := LookupResponseCode(ChannelDomestic, code)
+	if !ok {
+		rc, _ = LookupResponseCode(ChannelInternational, code)
+	}
+	return rc
+}
+
+// Status ...
+func (r *DomesticResponse) Status() Status {
+	rc, _ := LookupResponseCode(ChannelDomestic, r.VPCTxnResponseCode)
+	return rc.Status
+}
+
+// Retryable ...
+func (r *DomesticResponse) Retryable() bool {
+	rc, _ := LookupResponseCode(ChannelDomestic, r.VPCTxnResponseCode)
+	return rc.Retryable
+}
+
+// Status ...
+func (r *InternationalResponse) Status() Status {
+	rc, _ := LookupResponseCode(ChannelInternational, r.VPCTxnResponseCode)
+	return rc.Status
+}
+
+// Retryable ...
+func (r *InternationalResponse) Retryable() bool {
+	rc, _ := LookupResponseCode(ChannelInternational, r.VPCTxnResponseCode)
+	return rc.Retryable
+}
+
+// Status ...
+func (r *PaymentResult) Status() Status {
+	rc, _ := LookupResponseCode(r.Channel, r.TxnResponseCode)
+	return rc.Status
+}
+
+// Retryable ...
+func (r *PaymentResult) Retryable() bool {
+	rc, _ := LookupResponseCode(r.Channel, r.TxnResponseCode)
+	return rc.Retryable
+}
+
+// Status is StatusPending while OnePay does not know the MerchTxnRef
+// (vpc_DRExists=N), the customer may still be on the payment page.
+func (r *QueryDRAPIResponse) Status() Status {
+	if !r.Exists() {
+		return StatusPending
+	}
+	rc, _ := LookupResponseCode(r.channel, r.VPCTxnResponseCode)
+	return rc.Status
+}
+
+// Retryable ...
+func (r *QueryDRAPIResponse) Retryable() bool {
+	if !r.Exists() {
+		return true
+	}
+	rc, _ := LookupResponseCode(r.channel, r.VPCTxnResponseCode)
+	return rc.Retryable
+}
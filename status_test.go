@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatus(t *testing.T) {
+	Convey("Status", t, func() {
+		Convey("classifies response codes", func() {
+			status := func(code string) Status {
+				return (&DomesticResponse{VPCTxnResponseCode: code}).Status()
+			}
+
+			So(status("0"), ShouldEqual, StatusApproved)
+			So(status("1"), ShouldEqual, StatusDeclined)
+			So(status("99"), ShouldEqual, StatusCancelled)
+			So(status("253"), ShouldEqual, StatusExpired)
+			So(status(""), ShouldEqual, StatusPending)
+			So(status("42"), ShouldEqual, StatusUnknown)
+		})
+
+		Convey("flags retryable codes", func() {
+			retryable := func(code string) bool {
+				return (&DomesticResponse{VPCTxnResponseCode: code}).Retryable()
+			}
+
+			So(retryable("21"), ShouldBeTrue)
+			So(retryable("99"), ShouldBeTrue)
+			So(retryable("0"), ShouldBeFalse)
+			So(retryable("3"), ShouldBeFalse)
+			So(retryable("42"), ShouldBeFalse)
+		})
+
+		Convey("keeps StatusOf and Retryable for either channel", func() {
+			So(StatusOf("0"), ShouldEqual, StatusApproved)
+			So(StatusOf("99"), ShouldEqual, StatusCancelled)
+			So(StatusOf("F"), ShouldEqual, StatusDeclined)
+			So(StatusOf(""), ShouldEqual, StatusPending)
+			So(StatusOf("42"), ShouldEqual, StatusUnknown)
+
+			So(Retryable("21"), ShouldBeTrue)
+			So(Retryable("F"), ShouldBeTrue)
+			So(Retryable("3"), ShouldBeFalse)
+			So(Retryable("42"), ShouldBeFalse)
+		})
+
+		Convey("is exposed on responses", func() {
+			resp := &InternationalResponse{VPCTxnResponseCode: "F"}
+			So(resp.Status(), ShouldEqual, StatusDeclined)
+			So(resp.Retryable(), ShouldBeTrue)
+			So(resp.Result().Status(), ShouldEqual, StatusDeclined)
+
+			dr := &QueryDRAPIResponse{VPCDRExists: "N"}
+			So(dr.Status(), ShouldEqual, StatusPending)
+
+			dr = &QueryDRAPIResponse{VPCDRExists: "Y", VPCTxnResponseCode: "99", channel: ChannelDomestic}
+			So(dr.Status(), ShouldEqual, StatusCancelled)
+			So(dr.Retryable(), ShouldBeTrue)
+		})
+	})
+}
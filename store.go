@@ -0,0 +1,256 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defines store errors
+var (
+	ErrTransactionNotFound = errors.New("Transaction not found")
+	ErrTransactionExists   = errors.New("Transaction already exists")
+)
+
+// TransactionState ...
+type TransactionState string
+
+// Defines transaction states
+const (
+	StatePending  TransactionState = "pending"
+	StateApproved TransactionState = "approved"
+	StateFailed   TransactionState = "failed"
+	// StateExpired is set by the Reconciler on a checkout ONEPAY never
+	// heard of, see Reconciler.Expiry
+	StateExpired TransactionState = "expired"
+)
+
+// Final reports whether no further transition is expected.
+func (s TransactionState) Final() bool {
+	return s == StateApproved || s == StateFailed || s == StateExpired
+}
+
+func stateFromResponseCode(channel Channel, code string) TransactionState {
+	rc, _ := LookupResponseCode(channel, code)
+
+	switch rc.Status {
+	case StatusPending, StatusUnknown:
+		return StatePending
+	case StatusApproved:
+		return StateApproved
+	default:
+		return StateFailed
+	}
+}
+
+// Transaction is what a TransactionStore remembers about a MerchTxnRef.
+type Transaction struct {
+	MerchTxnRef string  `json:"merch_txn_ref"`
+	Channel     Channel `json:"channel"`
+	OrderInfo   string  `json:"order_info"`
+	// Amount is in the minor unit of Currency, see Money
+	Amount          int64            `json:"amount"`
+	Currency        string           `json:"currency"`
+	State           TransactionState `json:"state"`
+	TxnResponseCode string           `json:"txn_response_code"`
+	TransactionNo   string           `json:"transaction_no"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+}
+
+// TransactionStore keeps track of checkouts. The clients Create a pending
+// transaction in BuildCheckoutURL and Update it once, when HandleCallback or
+// QueryDR first reports a final state.
+type TransactionStore interface {
+	// Create returns ErrTransactionExists if MerchTxnRef is already stored.
+	Create(ctx context.Context, txn *Transaction) error
+	// Get returns ErrTransactionNotFound if MerchTxnRef is unknown.
+	Get(ctx context.Context, merchTxnRef string) (*Transaction, error)
+	// Update returns ErrTransactionNotFound if MerchTxnRef is unknown.
+	Update(ctx context.Context, txn *Transaction) error
+	// Settle updates txn only while the stored transaction is pending, in
+	// one atomic step, and reports whether it did.
+	Settle(ctx context.Context, txn *Transaction) (bool, error)
+	// ListPending returns at most limit pending transactions created before
+	// the given time, oldest first.
+	ListPending(ctx context.Context, before time.Time, limit int) ([]*Transaction, error)
+}
+
+func createTransaction(ctx context.Context, store TransactionStore, channel Channel, money Money, params *CheckoutParams) error {
+	if store == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	return store.Create(ctx, &Transaction{
+		MerchTxnRef: params.MerchTxnRef,
+		Channel:     channel,
+		OrderInfo:   params.OrderInfo,
+		Amount:      money.Amount,
+		Currency:    money.Currency,
+		State:       StatePending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+}
+
+// settleTransaction moves a pending transaction to the state of code and
+// reports whether it did. fn, when not nil, runs right before and an error
+// of it leaves the transaction pending, so the next callback retries it.
+// Transactions already final are left untouched, which makes replayed
+// callbacks harmless. Without a store every final code settles. Callers
+// hold the lock of merchTxnRef, see Locker.
+func settleTransaction(ctx context.Context, store TransactionStore, channel Channel, merchTxnRef, transactionNo, code string, fn func() error) (bool, error) {
+	state := stateFromResponseCode(channel, code)
+	if !state.Final() {
+		return false, nil
+	}
+
+	if store == nil {
+		if fn != nil {
+			err := fn()
+			return err == nil, err
+		}
+		return true, nil
+	}
+
+	txn, err := store.Get(ctx, merchTxnRef)
+	if err != nil {
+		return false, err
+	}
+
+	if txn.State.Final() {
+		return false, nil
+	}
+
+	if fn != nil {
+		err = fn()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	txn.State = state
+	txn.TxnResponseCode = code
+	txn.TransactionNo = transactionNo
+	txn.UpdatedAt = time.Now()
+
+	// another instance may settle it meanwhile if Locker is per process
+	return store.Settle(ctx, txn)
+}
+
+// expireTransaction moves a pending transaction to StateExpired and
+// reports whether it did.
+func expireTransaction(ctx context.Context, store TransactionStore, merchTxnRef string) (bool, error) {
+	txn, err := store.Get(ctx, merchTxnRef)
+	if err != nil {
+		return false, err
+	}
+
+	if txn.State.Final() {
+		return false, nil
+	}
+
+	txn.State = StateExpired
+	txn.UpdatedAt = time.Now()
+
+	return store.Settle(ctx, txn)
+}
+
+// MemoryStore is a TransactionStore for tests and single instance services.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	txns map[string]Transaction
+}
+
+// NewMemoryStore ...
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		txns: map[string]Transaction{},
+	}
+}
+
+// Create ...
+func (s *MemoryStore) Create(ctx context.Context, txn *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.txns[txn.MerchTxnRef]; ok {
+		return ErrTransactionExists
+	}
+
+	s.txns[txn.MerchTxnRef] = *txn
+	return nil
+}
+
+// Get ...
+func (s *MemoryStore) Get(ctx context.Context, merchTxnRef string) (*Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	txn, ok := s.txns[merchTxnRef]
+	if !ok {
+		return nil, ErrTransactionNotFound
+	}
+
+	return &txn, nil
+}
+
+// Update ...
+func (s *MemoryStore) Update(ctx context.Context, txn *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.txns[txn.MerchTxnRef]; !ok {
+		return ErrTransactionNotFound
+	}
+
+	s.txns[txn.MerchTxnRef] = *txn
+	return nil
+}
+
+// Settle ...
+func (s *MemoryStore) Settle(ctx context.Context, txn *Transaction) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.txns[txn.MerchTxnRef]
+	if !ok {
+		return false, ErrTransactionNotFound
+	}
+
+	if stored.State != StatePending {
+		return false, nil
+	}
+
+	s.txns[txn.MerchTxnRef] = *txn
+	return true, nil
+}
+
+// ListPending ...
+func (s *MemoryStore) ListPending(ctx context.Context, before time.Time, limit int) ([]*Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var txns []*Transaction
+	for _, txn := range s.txns {
+		if txn.State != StatePending || !txn.CreatedAt.Before(before) {
+			continue
+		}
+		txn := txn
+		txns = append(txns, &txn)
+	}
+
+	sort.Slice(txns, func(i, j int) bool {
+		return txns[i].CreatedAt.Before(txns[j].CreatedAt)
+	})
+
+	if limit > 0 && len(txns) > limit {
+		txns = txns[:limit]
+	}
+
+	return txns, nil
+}
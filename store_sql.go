@@ -0,0 +1,209 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLStore is a TransactionStore on top of database/sql.
+// Queries use '?' placeholders (SQLite, MySQL), set Rebind for other drivers.
+// Times are stored in UTC so they compare as expected in ListPending.
+type SQLStore struct {
+	DB    *sql.DB
+	Table string
+
+	// Rebind rewrites a query before it is sent, e.g. '?' to '$1' for Postgres
+	Rebind func(query string) string
+
+	// IsDuplicate reports whether an INSERT failed on the primary key,
+	// defaults to matching the messages of SQLite, MySQL and Postgres
+	IsDuplicate func(err error) bool
+}
+
+// NewSQLStore ...
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{
+		DB:    db,
+		Table: "onepay_transactions",
+	}
+}
+
+const sqlTransactionColumns = "merch_txn_ref, channel, order_info, amount, currency, state, txn_response_code, transaction_no, created_at, updated_at"
+
+func (s *SQLStore) query(query string) string {
+	query = strings.Replace(query, "{table}", s.Table, -1)
+	if s.Rebind != nil {
+		return s.Rebind(query)
+	}
+	return query
+}
+
+// Migrate creates the table if it does not exist.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, s.query(`CREATE TABLE IF NOT EXISTS {table} (
+	merch_txn_ref VARCHAR(40) NOT NULL PRIMARY KEY,
+	channel VARCHAR(16) NOT NULL,
+	order_info VARCHAR(34) NOT NULL,
+	amount BIGINT NOT NULL,
+	currency VARCHAR(3) NOT NULL,
+	state VARCHAR(16) NOT NULL,
+	txn_response_code VARCHAR(8) NOT NULL,
+	transaction_no VARCHAR(64) NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+)`))
+	return err
+}
+
+func (s *SQLStore) isDuplicate(err error) bool {
+	if s.IsDuplicate != nil {
+		return s.IsDuplicate(err)
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") ||
+		strings.Contains(msg, "Duplicate entry") ||
+		strings.Contains(msg, "duplicate key value")
+}
+
+// Create inserts txn, the primary key rejects a MerchTxnRef already
+// stored with ErrTransactionExists.
+func (s *SQLStore) Create(ctx context.Context, txn *Transaction) error {
+	_, err := s.DB.ExecContext(ctx,
+		s.query("INSERT INTO {table} ("+sqlTransactionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		txn.MerchTxnRef,
+		string(txn.Channel),
+		txn.OrderInfo,
+		txn.Amount,
+		txn.Currency,
+		string(txn.State),
+		txn.TxnResponseCode,
+		txn.TransactionNo,
+		txn.CreatedAt.UTC(),
+		txn.UpdatedAt.UTC(),
+	)
+	if err != nil && s.isDuplicate(err) {
+		return ErrTransactionExists
+	}
+	return err
+}
+
+// Get ...
+func (s *SQLStore) Get(ctx context.Context, merchTxnRef string) (*Transaction, error) {
+	row := s.DB.QueryRowContext(ctx,
+		s.query("SELECT "+sqlTransactionColumns+" FROM {table} WHERE merch_txn_ref = ?"),
+		merchTxnRef,
+	)
+
+	txn, err := scanTransaction(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return txn, nil
+}
+
+// ListPending ...
+func (s *SQLStore) ListPending(ctx context.Context, before time.Time, limit int) ([]*Transaction, error) {
+	query := "SELECT " + sqlTransactionColumns + " FROM {table} WHERE state = ? AND created_at < ? ORDER BY created_at"
+	args := []interface{}{string(StatePending), before.UTC()}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, s.query(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txns []*Transaction
+	for rows.Next() {
+		txn, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		txns = append(txns, txn)
+	}
+
+	return txns, rows.Err()
+}
+
+func scanTransaction(row interface {
+	Scan(dest ...interface{}) error
+}) (*Transaction, error) {
+	txn := &Transaction{}
+	err := row.Scan(
+		&txn.MerchTxnRef,
+		&txn.Channel,
+		&txn.OrderInfo,
+		&txn.Amount,
+		&txn.Currency,
+		&txn.State,
+		&txn.TxnResponseCode,
+		&txn.TransactionNo,
+		&txn.CreatedAt,
+		&txn.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return txn, nil
+}
+
+// Update ...
+func (s *SQLStore) Update(ctx context.Context, txn *Transaction) error {
+	res, err := s.DB.ExecContext(ctx,
+		s.query("UPDATE {table} SET state = ?, txn_response_code = ?, transaction_no = ?, updated_at = ? WHERE merch_txn_ref = ?"),
+		string(txn.State),
+		txn.TxnResponseCode,
+		txn.TransactionNo,
+		txn.UpdatedAt.UTC(),
+		txn.MerchTxnRef,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Update %s: %v", txn.MerchTxnRef, err)
+	}
+
+	if n == 0 {
+		return ErrTransactionNotFound
+	}
+
+	return nil
+}
+
+// Settle ...
+func (s *SQLStore) Settle(ctx context.Context, txn *Transaction) (bool, error) {
+	res, err := s.DB.ExecContext(ctx,
+		s.query("UPDATE {table} SET state = ?, txn_response_code = ?, transaction_no = ?, updated_at = ? WHERE merch_txn_ref = ? AND state = ?"),
+		string(txn.State),
+		txn.TxnResponseCode,
+		txn.TransactionNo,
+		txn.UpdatedAt.UTC(),
+		txn.MerchTxnRef,
+		string(StatePending),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Settle %s: %v", txn.MerchTxnRef, err)
+	}
+
+	return n == 1, nil
+}
@@ -0,0 +1,137 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTransactionStore(t *testing.T) {
+	Convey("TransactionStore", t, func() {
+		db, err := sql.Open("sqlite3", ":memory:")
+		So(err, ShouldBeNil)
+		defer db.Close()
+		// every connection would get its own :memory: database
+		db.SetMaxOpenConns(1)
+
+		sqlStore := NewSQLStore(db)
+		So(sqlStore.Migrate(context.Background()), ShouldBeNil)
+
+		for name, store := range map[string]TransactionStore{
+			"memory": NewMemoryStore(),
+			"sql":    sqlStore,
+		} {
+			Convey(name, func() {
+				ctx := context.Background()
+				now := time.Now().UTC().Truncate(time.Second)
+
+				txn := &Transaction{
+					MerchTxnRef: "ref-1",
+					Channel:     ChannelDomestic,
+					OrderInfo:   "order 1",
+					Amount:      100000,
+					Currency:    "VND",
+					State:       StatePending,
+					CreatedAt:   now,
+					UpdatedAt:   now,
+				}
+				So(store.Create(ctx, txn), ShouldBeNil)
+				So(store.Create(ctx, txn), ShouldEqual, ErrTransactionExists)
+
+				got, err := store.Get(ctx, "ref-1")
+				So(err, ShouldBeNil)
+				So(got.State, ShouldEqual, StatePending)
+				So(got.Amount, ShouldEqual, 100000)
+				So(got.CreatedAt.Equal(now), ShouldBeTrue)
+
+				_, err = store.Get(ctx, "ref-2")
+				So(err, ShouldEqual, ErrTransactionNotFound)
+
+				pending, err := store.ListPending(ctx, now.Add(time.Second), 10)
+				So(err, ShouldBeNil)
+				So(len(pending), ShouldEqual, 1)
+
+				pending, err = store.ListPending(ctx, now, 10)
+				So(err, ShouldBeNil)
+				So(pending, ShouldBeEmpty)
+
+				got.State = StateApproved
+				got.TransactionNo = "000001"
+				settled, err := store.Settle(ctx, got)
+				So(err, ShouldBeNil)
+				So(settled, ShouldBeTrue)
+
+				// a concurrent settle finds it final already
+				failed := *got
+				failed.State = StateFailed
+				settled, err = store.Settle(ctx, &failed)
+				So(err, ShouldBeNil)
+				So(settled, ShouldBeFalse)
+
+				So(store.Update(ctx, got), ShouldBeNil)
+
+				got, err = store.Get(ctx, "ref-1")
+				So(err, ShouldBeNil)
+				So(got.State, ShouldEqual, StateApproved)
+				So(got.TransactionNo, ShouldEqual, "000001")
+
+				pending, err = store.ListPending(ctx, now.Add(time.Second), 10)
+				So(err, ShouldBeNil)
+				So(pending, ShouldBeEmpty)
+
+				So(store.Update(ctx, &Transaction{MerchTxnRef: "ref-2"}), ShouldEqual, ErrTransactionNotFound)
+			})
+		}
+
+		Convey("HandleCallback settles once", func() {
+			op := NewSandboxDomestic("https://example.com/callback")
+			op.Store = NewMemoryStore()
+
+			_, err := op.BuildCheckoutURL(&CheckoutParams{
+				Amount:      100000,
+				OrderInfo:   "order 1",
+				MerchTxnRef: "ref-1",
+				TicketNo:    "127.0.0.1",
+				Title:       "Checkout",
+				AgainLink:   "https://example.com/cart",
+			})
+			So(err, ShouldBeNil)
+
+			txn, err := op.Store.Get(context.Background(), "ref-1")
+			So(err, ShouldBeNil)
+			So(txn.State, ShouldEqual, StatePending)
+
+			callback := func(code string) {
+				v := url.Values{}
+				v.Set("vpc_Merchant", op.Cfg.Merchant)
+				v.Set("vpc_MerchTxnRef", "ref-1")
+				v.Set("vpc_Amount", "10000000")
+				v.Set("vpc_TransactionNo", "000001")
+				v.Set("vpc_TxnResponseCode", code)
+				addSecureHash(&v, op.Cfg.SecureSecret)
+
+				_, err := op.HandleCallback(v)
+				So(err, ShouldBeNil)
+			}
+
+			// an unknown code may still turn out approved, QueryDR later
+			callback("42")
+			txn, err = op.Store.Get(context.Background(), "ref-1")
+			So(err, ShouldBeNil)
+			So(txn.State, ShouldEqual, StatePending)
+
+			callback("0")
+			callback("1")
+
+			txn, err = op.Store.Get(context.Background(), "ref-1")
+			So(err, ShouldBeNil)
+			So(txn.State, ShouldEqual, StateApproved)
+			So(txn.TxnResponseCode, ShouldEqual, "0")
+		})
+	})
+}
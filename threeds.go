@@ -0,0 +1,254 @@
+package payment
+
+import (
+	"net/url"
+	"strings"
+)
+
+// CardScheme ...
+type CardScheme string
+
+// Defines the card schemes accepted by the international gateway
+const (
+	SchemeVisa       CardScheme = "visa"
+	SchemeMasterCard CardScheme = "mastercard"
+	SchemeJCB        CardScheme = "jcb"
+	SchemeAmex       CardScheme = "amex"
+	SchemeUnknown    CardScheme = "unknown"
+)
+
+// CardSchemeOf maps vpc_Card (VC, MC, JC, AE) to a CardScheme.
+func CardSchemeOf(card string) CardScheme {
+	switch strings.ToUpper(strings.TrimSpace(card)) {
+	case "VC", "VI", "VISA":
+		return SchemeVisa
+	case "MC", "MASTERCARD":
+		return SchemeMasterCard
+	case "JC", "JCB":
+		return SchemeJCB
+	case "AE", "AX", "AMEX":
+		return SchemeAmex
+	default:
+		return SchemeUnknown
+	}
+}
+
+// ThreeDSAuthentication is the outcome of the 3-D Secure step.
+type ThreeDSAuthentication string
+
+// Defines the outcomes of 3-D Secure
+const (
+	// ThreeDSAuthenticated the cardholder passed the challenge of the issuer
+	ThreeDSAuthenticated ThreeDSAuthentication = "authenticated"
+	// ThreeDSAttempted the issuer or the card does not support 3-D Secure,
+	// the attempt is recorded
+	ThreeDSAttempted ThreeDSAuthentication = "attempted"
+	ThreeDSFailed    ThreeDSAuthentication = "failed"
+	// ThreeDSNotEnrolled the card is not enrolled in 3-D Secure
+	ThreeDSNotEnrolled ThreeDSAuthentication = "not_enrolled"
+	// ThreeDSUnavailable the directory server or the issuer could not be reached
+	ThreeDSUnavailable ThreeDSAuthentication = "unavailable"
+	// ThreeDSNotPerformed the response carries no 3-D Secure data
+	ThreeDSNotPerformed ThreeDSAuthentication = "not_performed"
+)
+
+var threeDSMessages = map[ThreeDSAuthentication]ErrorMessageLocale{
+	ThreeDSAuthenticated: {
+		VN: "Chủ thẻ đã xác thực 3-D Secure thành công",
+		EN: "Cardholder fully authenticated by 3-D Secure",
+	},
+	ThreeDSAttempted: {
+		VN: "Đã thử xác thực 3-D Secure, ngân hàng phát hành không hỗ trợ",
+		EN: "3-D Secure authentication attempted",
+	},
+	ThreeDSFailed: {
+		VN: "Xác thực 3-D Secure không thành công",
+		EN: "3-D Secure authentication failed",
+	},
+	ThreeDSNotEnrolled: {
+		VN: "Thẻ chưa đăng ký 3-D Secure",
+		EN: "Card not enrolled in 3-D Secure",
+	},
+	ThreeDSUnavailable: {
+		VN: "Không thể xác thực 3-D Secure",
+		EN: "3-D Secure authentication unavailable",
+	},
+	ThreeDSNotPerformed: {
+		VN: "Không thực hiện xác thực 3-D Secure",
+		EN: "3-D Secure not performed",
+	},
+}
+
+// ThreeDSResult interprets the 3-D Secure fields of a response.
+type ThreeDSResult struct {
+	Scheme CardScheme `json:"scheme"`
+	// ECI, Enrolled and Status are the raw vpc_3DSECI, vpc_3DSenrolled
+	// and vpc_3DSstatus (or vpc_VerStatus when 3DSstatus is missing)
+	ECI      string `json:"eci"`
+	Enrolled string `json:"enrolled"`
+	Status   string `json:"status"`
+
+	Authentication ThreeDSAuthentication `json:"authentication"`
+	// Authenticated is true only when the cardholder passed the challenge
+	Authenticated bool `json:"authenticated"`
+	// LiabilityShift is true when a chargeback for fraud is borne by the
+	// issuer: fully authenticated or attempted transactions
+	LiabilityShift bool               `json:"liability_shift"`
+	Message        ErrorMessageLocale `json:"message"`
+}
+
+// eciAuthentication decodes ECI, Visa, JCB and Amex use 05/06/07 while
+// MasterCard uses 02/01/00. Without a known scheme the value decides.
+func eciAuthentication(scheme CardScheme, eci string) (ThreeDSAuthentication, bool) {
+	eci = strings.TrimSpace(eci)
+	if len(eci) == 1 {
+		eci = "0" + eci
+	}
+
+	mastercard := map[string]ThreeDSAuthentication{
+		"02": ThreeDSAuthenticated,
+		"01": ThreeDSAttempted,
+		"00": ThreeDSFailed,
+	}
+	others := map[string]ThreeDSAuthentication{
+		"05": ThreeDSAuthenticated,
+		"06": ThreeDSAttempted,
+		"07": ThreeDSFailed,
+	}
+
+	var auth ThreeDSAuthentication
+	var ok bool
+	switch scheme {
+	case SchemeMasterCard:
+		auth, ok = mastercard[eci]
+	case SchemeVisa, SchemeJCB, SchemeAmex:
+		auth, ok = others[eci]
+	default:
+		if auth, ok = others[eci]; !ok {
+			auth, ok = mastercard[eci]
+		}
+	}
+
+	return auth, ok
+}
+
+// statusAuthentication decodes vpc_3DSstatus, the PARes status where A
+// is an attempted authentication.
+func statusAuthentication(status string) (ThreeDSAuthentication, bool) {
+	switch strings.ToUpper(strings.TrimSpace(status)) {
+	case "Y":
+		return ThreeDSAuthenticated, true
+	case "A", "M":
+		return ThreeDSAttempted, true
+	case "N", "F", "S":
+		return ThreeDSFailed, true
+	case "E":
+		return ThreeDSNotEnrolled, true
+	case "U", "D", "C", "I", "P", "T":
+		return ThreeDSUnavailable, true
+	default:
+		return "", false
+	}
+}
+
+// verStatusAuthentication decodes vpc_VerStatus, where A is a failed
+// authentication and M an attempted one.
+func verStatusAuthentication(status string) (ThreeDSAuthentication, bool) {
+	switch strings.ToUpper(strings.TrimSpace(status)) {
+	case "Y":
+		return ThreeDSAuthenticated, true
+	case "M":
+		return ThreeDSAttempted, true
+	case "A", "N", "F", "S":
+		return ThreeDSFailed, true
+	case "E":
+		return ThreeDSNotEnrolled, true
+	case "U", "D", "C", "I", "P", "T":
+		return ThreeDSUnavailable, true
+	default:
+		return "", false
+	}
+}
+
+// DecodeThreeDS interprets the 3-D Secure fields, the ECI wins over the
+// status when both are present.
+func DecodeThreeDS(card, eci, enrolled, status string) ThreeDSResult {
+	return decodeThreeDS(card, eci, enrolled, status, statusAuthentication)
+}
+
+// DecodeThreeDSVerStatus is DecodeThreeDS for a response carrying
+// vpc_VerStatus instead of vpc_3DSstatus.
+func DecodeThreeDSVerStatus(card, eci, enrolled, verStatus string) ThreeDSResult {
+	return decodeThreeDS(card, eci, enrolled, verStatus, verStatusAuthentication)
+}
+
+func decodeThreeDS(card, eci, enrolled, status string, statusAuthentication func(string) (ThreeDSAuthentication, bool)) ThreeDSResult {
+	res := ThreeDSResult{
+		Scheme:   CardSchemeOf(card),
+		ECI:      eci,
+		Enrolled: enrolled,
+		Status:   status,
+	}
+
+	auth, ok := eciAuthentication(res.Scheme, eci)
+	if ok && auth == ThreeDSFailed {
+		// not authenticated by ECI, the status tells why
+		if byStatus, found := statusAuthentication(status); found && byStatus != ThreeDSAuthenticated && byStatus != ThreeDSAttempted {
+			auth = byStatus
+		}
+	}
+
+	if !ok {
+		auth, ok = statusAuthentication(status)
+	}
+
+	if !ok {
+		switch strings.ToUpper(strings.TrimSpace(enrolled)) {
+		case "N":
+			auth = ThreeDSNotEnrolled
+		case "U":
+			auth = ThreeDSUnavailable
+		default:
+			auth = ThreeDSNotPerformed
+		}
+	}
+
+	res.Authentication = auth
+	res.Authenticated = auth == ThreeDSAuthenticated
+	res.LiabilityShift = auth == ThreeDSAuthenticated || auth == ThreeDSAttempted
+	res.Message = threeDSMessages[auth]
+
+	return res
+}
+
+// threeDSKeys are spelled vpc_3DS* by the international gateway and
+// vpc_3Ds* by the domestic one.
+var threeDSKeys = [][2]string{
+	{"vpc_3DSenrolled", "vpc_3Dsenrolled"},
+	{"vpc_3DSstatus", "vpc_3Dsstatus"},
+	{"vpc_3DSECI", "vpc_3DsECI"},
+}
+
+// normalizeThreeDSKeys returns a copy of v where every 3-D Secure key is
+// present in both spellings, so both responses decode either one.
+func normalizeThreeDSKeys(v url.Values) map[string][]string {
+	m := make(map[string][]string, len(v))
+	for key, values := range v {
+		m[key] = values
+	}
+
+	for _, keys := range threeDSKeys {
+		if _, ok := m[keys[0]]; !ok {
+			if values, ok := m[keys[1]]; ok {
+				m[keys[0]] = values
+			}
+		}
+		if _, ok := m[keys[1]]; !ok {
+			if values, ok := m[keys[0]]; ok {
+				m[keys[1]] = values
+			}
+		}
+	}
+
+	return m
+}
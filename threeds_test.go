@@ -0,0 +1,96 @@
+package payment
+
+import (
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestThreeDS(t *testing.T) {
+	Convey("3-D Secure", t, func() {
+		Convey("decodes ECI per scheme", func() {
+			res := DecodeThreeDS("VC", "05", "Y", "Y")
+			So(res.Scheme, ShouldEqual, SchemeVisa)
+			So(res.Authenticated, ShouldBeTrue)
+			So(res.LiabilityShift, ShouldBeTrue)
+
+			res = DecodeThreeDS("MC", "02", "Y", "Y")
+			So(res.Authentication, ShouldEqual, ThreeDSAuthenticated)
+
+			res = DecodeThreeDS("MC", "01", "Y", "A")
+			So(res.Authentication, ShouldEqual, ThreeDSAttempted)
+			So(res.Authenticated, ShouldBeFalse)
+			So(res.LiabilityShift, ShouldBeTrue)
+
+			// 05 means nothing for MasterCard
+			res = DecodeThreeDS("MC", "05", "", "")
+			So(res.Authentication, ShouldEqual, ThreeDSNotPerformed)
+		})
+
+		Convey("explains a failed authentication", func() {
+			res := DecodeThreeDS("VC", "07", "Y", "N")
+			So(res.Authentication, ShouldEqual, ThreeDSFailed)
+			So(res.LiabilityShift, ShouldBeFalse)
+
+			res = DecodeThreeDS("VC", "07", "N", "E")
+			So(res.Authentication, ShouldEqual, ThreeDSNotEnrolled)
+		})
+
+		Convey("falls back on the status and enrollment", func() {
+			So(DecodeThreeDS("", "", "Y", "Y").Authentication, ShouldEqual, ThreeDSAuthenticated)
+			So(DecodeThreeDS("", "", "N", "").Authentication, ShouldEqual, ThreeDSNotEnrolled)
+			So(DecodeThreeDS("", "", "", "").Authentication, ShouldEqual, ThreeDSNotPerformed)
+		})
+
+		Convey("decodes vpc_VerStatus with its own codes", func() {
+			failed := DecodeThreeDSVerStatus("VC", "", "", "A")
+			So(failed.Authentication, ShouldEqual, ThreeDSFailed)
+			So(failed.LiabilityShift, ShouldBeFalse)
+
+			So(DecodeThreeDSVerStatus("VC", "", "", "E").Authentication, ShouldEqual, ThreeDSNotEnrolled)
+			So(DecodeThreeDSVerStatus("VC", "", "", "U").Authentication, ShouldEqual, ThreeDSUnavailable)
+			So(DecodeThreeDSVerStatus("VC", "", "", "M").Authentication, ShouldEqual, ThreeDSAttempted)
+
+			// the PARes status A is an attempt
+			So(DecodeThreeDS("VC", "", "", "A").Authentication, ShouldEqual, ThreeDSAttempted)
+
+			resp := &InternationalResponse{VPCCard: "VC", VPCVerStatus: "A"}
+			resp.PostProcess()
+			So(resp.ThreeDS.Authentication, ShouldEqual, ThreeDSFailed)
+			So(resp.ThreeDS.LiabilityShift, ShouldBeFalse)
+		})
+
+		Convey("normalizes both spellings", func() {
+			v := url.Values{}
+			v.Set("vpc_MerchTxnRef", "ref-1")
+			v.Set("vpc_TxnResponseCode", "0")
+			v.Set("vpc_Card", "VC")
+			v.Set("vpc_3DSECI", "05")
+			v.Set("vpc_3DSenrolled", "Y")
+			v.Set("vpc_3DSstatus", "Y")
+
+			dom := NewSandboxDomestic("https://example.com/callback")
+			addSecureHash(&v, dom.Cfg.SecureSecret)
+			resp, err := dom.HandleCallback(v)
+			So(err, ShouldBeNil)
+			So(resp.VPC3Dsstatus, ShouldEqual, "Y")
+			So(resp.ThreeDS.Authenticated, ShouldBeTrue)
+			So(v.Get("vpc_3Dsstatus"), ShouldBeEmpty)
+
+			v.Del("vpc_3DSenrolled")
+			v.Del("vpc_3DSstatus")
+			v.Set("vpc_3Dsenrolled", "Y")
+			v.Set("vpc_3Dsstatus", "A")
+			v.Set("vpc_3DSECI", "06")
+
+			intl := NewSandboxInternational("https://example.com/callback")
+			addSecureHash(&v, intl.Cfg.SecureSecret)
+			iresp, err := intl.HandleCallback(v)
+			So(err, ShouldBeNil)
+			So(iresp.VPC3DSstatus, ShouldEqual, "A")
+			So(iresp.ThreeDS.Authentication, ShouldEqual, ThreeDSAttempted)
+			So(iresp.ThreeDS.LiabilityShift, ShouldBeTrue)
+		})
+	})
+}